@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/mxk/go-cli"
 
@@ -24,6 +25,9 @@ func (cmd *dupCmd) Main(args []string) error {
 	if err != nil {
 		return err
 	}
+	if n := len(x.Errors()); n > 0 {
+		log.Printf("Index contains %d paths that could not be indexed; directories containing them are never duplicates", n)
+	}
 	t := x.ToTree()
 	dups := t.Dups(".", 0, 10)
 	for _, dup := range dups {
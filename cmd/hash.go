@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync/atomic"
 
 	"github.com/mxk/go-cli"
@@ -15,33 +18,66 @@ import (
 var _ = cli.Main.Add(&cli.Cfg{
 	Name:    "hash",
 	Usage:   "file ...",
-	Summary: "Calculate BLAKE3 digests for one or more files",
+	Summary: "Calculate digests for one or more files",
 	MinArgs: 1,
 	New:     func() cli.Cmd { return &hashCmd{} },
 })
 
 type hashCmd struct {
-	Cmp bool `cli:"Report whether file contents are identical"`
+	Cmp       bool            `cli:"Report whether file contents are identical"`
+	Hash      index.Algorithm `cli:"Use hash {algorithm} (blake3, sha256, or sha512/256)"`
+	Sum       bool            `cli:"Write lowercase digests and escaped names compatible with b3sum and sha256sum"`
+	Check     bool            `cli:"Verify digests listed in manifest files"`
+	Recursive bool            `cli:"Hash all files in directories"`
+}
+
+func (*hashCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Calculate file digests. A file name of '-' reads standard input.
+
+	With -recursive, directories are hashed using the same parallel scanner as
+	the index commands and their files are listed in path order.
+
+	With -check, each argument is a manifest in the b3sum or sha256sum format.
+	Listed files are hashed with the selected algorithm and reported as OK or
+	FAILED. The exit status is non-zero if any file does not match or cannot be
+	read.
+	`)
 }
 
 func (cmd *hashCmd) Main(args []string) error {
-	if len(args) == 1 {
-		r := hash(index.NewHasher(nil), args, 0)
-		if r.print(); r.err != nil {
-			r.err = cli.ExitCode(1)
+	if !cmd.Hash.IsPrimary() {
+		return cli.Errorf("not a primary hash algorithm: %v", cmd.Hash)
+	}
+	if cmd.Check {
+		return cmd.check(args)
+	}
+	var c hashCmp
+	cmd.run(args, func(r *hashResult) {
+		c.result(r)
+		cmd.print(r)
+	})
+	if cmd.Cmp && c.err == nil {
+		what := "identical"
+		if c.diff {
+			what = "different"
+			c.err = cli.ExitCode(1)
 		}
-		return r.err
+		_, _ = fmt.Fprintln(os.Stderr, "Files are", what)
 	}
+	return c.err
+}
 
-	// Hash files
+// run hashes names in parallel and calls fn with each result in names order.
+func (cmd *hashCmd) run(names []string, fn func(r *hashResult)) {
 	var next, workers atomic.Int32
 	done := make(chan *hashResult, 1)
-	for n := workers.Add(int32(min(len(args), runtime.NumCPU()))); n > 0; n-- {
+	for n := workers.Add(int32(min(len(names), runtime.NumCPU()))); n > 0; n-- {
 		go func() {
-			h := index.NewHasher(nil)
-			for i := next.Load(); int(i) < len(args); i = next.Load() {
+			h := cmd.Hash.NewHasher(nil)
+			for i := next.Load(); int(i) < len(names); i = next.Load() {
 				if next.CompareAndSwap(i, i+1) {
-					done <- hash(h, args, int(i))
+					done <- cmd.hash(h, names[i], int(i))
 				}
 			}
 			if workers.Add(-1) == 0 {
@@ -49,75 +85,188 @@ func (cmd *hashCmd) Main(args []string) error {
 			}
 		}()
 	}
-
-	// Receive results
-	var q hashQueue
+	var out int
+	pending := make(map[int]*hashResult)
 	for r := range done {
-		q.result(r)
-	}
-	if cmd.Cmp && q.err == nil {
-		what := "identical"
-		if q.diff {
-			what = "different"
-			q.err = cli.ExitCode(1)
+		for pending[r.i] = r; pending[out] != nil; out++ {
+			fn(pending[out])
+			delete(pending, out)
 		}
-		_, _ = fmt.Fprintln(os.Stderr, "Files are", what)
 	}
-	return q.err
 }
 
-type hashQueue struct {
-	next int
-	done map[int]*hashResult
-	want index.Digest
-	diff bool
-	err  error
+// hash computes the digest of the specified file, standard input, or
+// directory.
+func (cmd *hashCmd) hash(h *index.Hasher, name string, i int) *hashResult {
+	r := &hashResult{i: i, name: name}
+	if name == "-" {
+		r.d, _, r.err = h.ReadStream(os.Stdin)
+		return r
+	}
+	r.name = filepath.Clean(name)
+	if fi, err := os.Stat(r.name); err == nil && fi.IsDir() {
+		if cmd.Recursive {
+			r.dir, r.sub = true, cmd.hashDir(r.name)
+		} else {
+			r.err = fmt.Errorf("%s: is a directory", r.name)
+		}
+		return r
+	}
+	f, err := h.Read(nil, r.name, false)
+	if r.err = err; err == nil {
+		r.d = f.Digest()
+	}
+	return r
 }
 
-func (q *hashQueue) result(r *hashResult) {
-	if r.err != nil {
-		q.err = cli.ExitCode(1)
-	} else if !q.diff {
-		if q.want == (index.Digest{}) {
-			q.want = r.f.Digest()
-		} else if q.want != r.f.Digest() {
-			q.diff = true
+// hashDir hashes all files in dir with the index scanner, which hashes multiple
+// files and the segments of large files in parallel.
+func (cmd *hashCmd) hashDir(dir string) (rs []*hashResult) {
+	s := &index.Scanner{
+		Hash:  cmd.Hash,
+		ErrFn: func(err error) { rs = append(rs, &hashResult{name: dir, err: err}) },
+	}
+	x, err := s.Scan(context.Background(), os.DirFS(dir))
+	if err != nil {
+		return append(rs, &hashResult{name: dir, err: err})
+	}
+	// Empty files have name-based digests in the index
+	empty, _, _ := cmd.Hash.NewHasher(nil).ReadStream(strings.NewReader(""))
+	for _, f := range x.Files() {
+		r := &hashResult{name: filepath.Join(dir, filepath.FromSlash(f.String())), d: f.Digest()}
+		if f.Size() == 0 {
+			r.d = empty
 		}
+		rs = append(rs, r)
 	}
-	if r.i != q.next {
-		if q.done == nil {
-			q.done = make(map[int]*hashResult)
+	return
+}
+
+// print writes the digests of r to stdout and any errors to stderr.
+func (cmd *hashCmd) print(r *hashResult) {
+	r.each(func(r *hashResult) {
+		switch {
+		case r.err != nil:
+			_, _ = fmt.Fprintln(os.Stderr, r.err)
+		case cmd.Sum:
+			_, _ = os.Stdout.Write(index.AppendManifestLine(nil, r.d[:], r.name))
+		default:
+			fmt.Printf("%X  %s\n", r.d, r.name)
 		}
-		q.done[r.i] = r
-		return
+	})
+}
+
+// check verifies the digests listed in the specified manifest files.
+func (cmd *hashCmd) check(manifests []string) error {
+	var want []index.ManifestEntry
+	var invalid int
+	for _, m := range manifests {
+		all, n, err := readManifest(m)
+		if err != nil {
+			return err
+		}
+		for _, e := range all {
+			if len(e.Sum) == len(index.Digest{}) {
+				want = append(want, e)
+			} else {
+				n++
+			}
+		}
+		invalid += n
+	}
+	if len(want) == 0 {
+		return fmt.Errorf("no properly formatted lines found")
+	}
+	names := make([]string, len(want))
+	for i, e := range want {
+		names[i] = e.Name
 	}
-	for {
-		r.print()
-		q.next++
-		if r = q.done[q.next]; r == nil {
-			break
+	var failed, unreadable int
+	cmd.run(names, func(r *hashResult) {
+		name, esc := index.EscapeManifestName(want[r.i].Name)
+		if esc {
+			name = `\` + name
 		}
-		delete(q.done, q.next)
+		switch {
+		case r.err != nil:
+			_, _ = fmt.Fprintln(os.Stderr, r.err)
+			unreadable++
+			fmt.Printf("%s: FAILED open or read\n", name)
+		case !bytes.Equal(r.d[:], want[r.i].Sum):
+			failed++
+			fmt.Printf("%s: FAILED\n", name)
+		default:
+			fmt.Printf("%s: OK\n", name)
+		}
+	})
+	warn := func(n int, one, many string) {
+		if n == 1 {
+			_, _ = fmt.Fprintln(os.Stderr, "WARNING: 1", one)
+		} else if n > 1 {
+			_, _ = fmt.Fprintln(os.Stderr, "WARNING:", n, many)
+		}
+	}
+	warn(invalid, "line is improperly formatted", "lines are improperly formatted")
+	warn(unreadable, "listed file could not be read", "listed files could not be read")
+	warn(failed, "computed checksum did NOT match", "computed checksums did NOT match")
+	if invalid+unreadable+failed > 0 {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
+
+// readManifest reads the entries of manifest name. A name of '-' reads
+// standard input.
+func readManifest(name string) ([]index.ManifestEntry, int, error) {
+	if name == "-" {
+		return index.ReadManifest(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer func() { _ = f.Close() }()
+	return index.ReadManifest(f)
+}
+
+// hashCmp compares the digests of all files.
+type hashCmp struct {
+	want index.Digest
+	diff bool
+	err  error
+}
+
+// result records the digests and errors of r.
+func (c *hashCmp) result(r *hashResult) {
+	r.each(func(r *hashResult) {
+		if r.err != nil {
+			c.err = cli.ExitCode(1)
+		} else if !c.diff {
+			if c.want == (index.Digest{}) {
+				c.want = r.d
+			} else if c.want != r.d {
+				c.diff = true
+			}
+		}
+	})
 }
 
 type hashResult struct {
 	i    int
 	name string
-	f    *index.File
+	d    index.Digest
 	err  error
+	dir  bool
+	sub  []*hashResult // Directory contents
 }
 
-func hash(h *index.Hasher, names []string, i int) *hashResult {
-	name := filepath.Clean(names[i])
-	f, err := h.Read(nil, name, false)
-	return &hashResult{i, name, f, err}
-}
-
-func (r *hashResult) print() {
-	if r.err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, r.err)
-	} else {
-		fmt.Printf("%X  %s\n", r.f.Digest(), r.name)
+// each calls fn for r or, if r is a directory, for each of its files.
+func (r *hashResult) each(fn func(r *hashResult)) {
+	if !r.dir {
+		fn(r)
+		return
+	}
+	for _, r := range r.sub {
+		fn(r)
 	}
 }
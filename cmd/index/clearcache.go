@@ -0,0 +1,44 @@
+package index
+
+import (
+	"context"
+	"log"
+	"os/signal"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "clear-cache|cc",
+	Usage:   "<root>",
+	Summary: "Remove stale digests cached in extended attributes",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &clearCacheCmd{} },
+})
+
+type clearCacheCmd struct {
+	All bool `cli:"Remove all cached digests, not just stale ones"`
+}
+
+func (*clearCacheCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Remove digests cached in extended attributes by the -xattr scan option from
+	files under root whose size, modification time, or inode number no longer
+	match. Linux only.
+	`)
+}
+
+func (cmd *clearCacheCmd) Main(args []string) error {
+	var m monitor
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	n, err := index.ClearCache(ctx, args[0], cmd.All, m.err)
+	log.Printf("Removed %d cached digests", n)
+	if err == nil && m.walkErr {
+		err = cli.ExitCode(1)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "corrupt",
+	Usage:   "<index>",
+	Summary: "Find truncated copies and files that contain only zeros",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &corruptCmd{} },
+})
+
+type corruptCmd struct {
+	IO       ioCfg
+	Root     string `cli:"Change root directory"`
+	AllZeros bool   `cli:"all-zeros,Check files of any size for zeros, not only those without allocated space"`
+}
+
+func (*corruptCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Find files that are likely damaged copies left by failed copy operations.
+	Files whose contents are entirely zero are reported as ZERO. Files that
+	match the beginning of a larger file with the same name in another
+	directory are reported as TRUNCATED. The intact version, if any, is shown
+	in parentheses. Such files are safe to remove once the intact version is
+	confirmed.
+
+	Zero files are found without reading any files by comparing digests with
+	those of zeros. By default, only files without any allocated space, which
+	are recorded by scans on Linux, are checked. With -all-zeros, files of any
+	size are checked, which takes as long as hashing the largest file (without
+	parallelism for hashes other than BLAKE3). Truncated copies are found by
+	reading the larger files up to the size of the smaller ones. The index
+	should be up to date. The exit code is 1 if any files are reported.
+	`)
+}
+
+func (cmd *corruptCmd) Main(args []string) error {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.Root == "" {
+		cmd.Root = x.Root()
+	}
+	if _, err := os.Stat(cmd.Root); err != nil {
+		return err
+	}
+	var m monitor
+	s, err := cmd.IO.scanner(&m)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	all, err := s.FindCorrupt(ctx, x.ToTree(), os.DirFS(cmd.Root), cmd.AllZeros)
+	if err != nil {
+		return err
+	}
+	var zero, truncated int
+	w := bufio.NewWriter(os.Stdout)
+	for _, c := range all {
+		switch {
+		case !c.Zero:
+			truncated++
+			_, _ = fmt.Fprintf(w, "TRUNCATED\t%s\t(prefix of %s)\n", c, c.Full)
+		case c.Full != nil:
+			zero++
+			_, _ = fmt.Fprintf(w, "ZERO\t%s\t(intact copy %s)\n", c, c.Full)
+		default:
+			zero++
+			_, _ = fmt.Fprintf(w, "ZERO\t%s\n", c)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("Found %d files containing only zeros and %d truncated copies", zero, truncated)
+	if len(all) > 0 || m.walkErr {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
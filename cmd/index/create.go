@@ -1,11 +1,9 @@
 package index
 
 import (
-	"context"
-	"log"
+	"fmt"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/mxk/go-cli"
 
@@ -18,38 +16,49 @@ var _ = indexCli.Add(&cli.Cfg{
 	Summary: "Create a new file system index",
 	MinArgs: 2,
 	MaxArgs: 2,
-	New:     func() cli.Cmd { return createCmd{} },
+	New:     func() cli.Cmd { return &createCmd{Scan: newScanCfg()} },
 })
 
-type createCmd struct{}
-
-func (createCmd) Main(args []string) error {
-	root := filepath.Clean(args[1])
-	var m monitor
-	x, err := index.Scan(context.Background(), os.DirFS(root), m.err, m.report)
-	if err != nil {
-		return err
-	}
-	if err = x.Save(args[0]); err == nil && m.walkErr {
-		err = cli.ExitCode(1)
-	}
-	return err
+type createCmd struct {
+	Hash index.Algorithm `cli:"Compute digests with hash {algorithm} (blake3, sha256, or sha512/256)"`
+	Seed []string        `cli:"Reuse digests of unchanged files from an existing {index} (may be repeated)"`
+	Scan scanCfg
 }
 
-type monitor struct {
-	walkErr    bool
-	nextReport time.Duration
-}
+func (*createCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Create a new index of the root directory.
+
+	Seed indexes are matched to the new root by comparing their roots. If the new
+	root is a subdirectory of a seed's root or vice versa, paths are adjusted
+	accordingly. Otherwise, such as for a copy of a disk, paths are matched as
+	they are. Files with the same relative path, size, and modification time
+	reuse the seed's digest instead of being hashed. Earlier seeds take
+	precedence. All seeds must use the same hash algorithm as the new index.
 
-func (m *monitor) err(err error) {
-	m.walkErr = true
-	log.Println(err)
+	The hash algorithm is recorded in the index header and used by all
+	subsequent updates and verification. BLAKE3 is the fastest.
+	`)
 }
 
-func (m *monitor) report(p *index.Progress) {
-	const rate = 5 * time.Minute
-	if p.Duration() >= max(time.Minute, m.nextReport) || p.IsFinal() {
-		log.Println(p)
-		m.nextReport = (p.Duration() + rate).Round(rate)
+func (cmd *createCmd) Main(args []string) error {
+	root := filepath.Clean(args[1])
+	var t *index.Tree
+	if len(cmd.Seed) > 0 {
+		seeds := make([]*index.Index, len(cmd.Seed))
+		for i, name := range cmd.Seed {
+			x, err := index.Load(name)
+			if err != nil {
+				return err
+			}
+			if x.Hash() != cmd.Hash {
+				return fmt.Errorf("seed %s uses %v digests instead of %v", name, x.Hash(), cmd.Hash)
+			}
+			seeds[i] = x
+		}
+		t = index.Seed(root, seeds...)
+		cmd.Scan.seeded = true
 	}
+	cmd.Scan.hash = cmd.Hash
+	return cmd.Scan.run(args[0], t, os.DirFS(root))
 }
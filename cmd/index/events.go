@@ -0,0 +1,147 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+// eventRate is the interval between progress events.
+const eventRate = 10 * time.Second
+
+// eventLog writes scan events as newline-delimited JSON. Each event is an
+// object with a "type" field set to "progress", "error", or "summary".
+type eventLog struct {
+	w     io.Writer
+	enc   *json.Encoder
+	next  time.Duration
+	last  *progressEvent
+	errs  int
+	kinds map[index.ErrorKind]int
+}
+
+type progressEvent struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Elapsed     float64   `json:"elapsed_sec"`
+	HashedFiles uint64    `json:"hashed_files"`
+	HashedBytes uint64    `json:"hashed_bytes"`
+	ReusedFiles uint64    `json:"reused_files"`
+	ReusedBytes uint64    `json:"reused_bytes"`
+	TotalFiles  uint64    `json:"total_files,omitempty"`
+	TotalBytes  uint64    `json:"total_bytes,omitempty"`
+	FilesPerSec float64   `json:"files_per_sec"`
+	BytesPerSec float64   `json:"bytes_per_sec"`
+	Percent     *float64  `json:"percent,omitempty"`
+	ETA         *float64  `json:"eta_sec,omitempty"`
+	Active      []string  `json:"active,omitempty"`
+	Final       bool      `json:"final,omitempty"`
+}
+
+type errorEvent struct {
+	Type  string          `json:"type"`
+	Time  time.Time       `json:"time"`
+	Kind  index.ErrorKind `json:"kind"`
+	Path  string          `json:"path,omitempty"`
+	Error string          `json:"error"`
+}
+
+type summaryEvent struct {
+	Type       string                  `json:"type"`
+	Time       time.Time               `json:"time"`
+	Index      string                  `json:"index"`
+	OK         bool                    `json:"ok"`
+	Error      string                  `json:"error,omitempty"`
+	FileErrors int                     `json:"file_errors"`
+	ErrorKinds map[index.ErrorKind]int `json:"file_errors_by_kind,omitempty"`
+	Progress   *progressEvent          `json:"progress,omitempty"`
+}
+
+// openEventLog creates a new event log that writes to the specified file or
+// stderr if name is "-".
+func openEventLog(name string) (*eventLog, error) {
+	w := io.Writer(os.Stderr)
+	if name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &eventLog{w: w, enc: json.NewEncoder(w), kinds: make(map[index.ErrorKind]int)}, nil
+}
+
+// progress writes a progress event at eventRate intervals.
+func (l *eventLog) progress(p *index.Progress) {
+	if p.Duration() < l.next && !p.IsFinal() {
+		return
+	}
+	l.next = (p.Duration() + eventRate).Truncate(eventRate)
+	e := &progressEvent{
+		Type:    "progress",
+		Time:    time.Now(),
+		Elapsed: p.Duration().Seconds(),
+		Active:  p.Active(),
+		Final:   p.IsFinal(),
+	}
+	e.HashedFiles, e.HashedBytes = p.Hashed()
+	e.ReusedFiles, e.ReusedBytes = p.Reused()
+	e.TotalFiles, e.TotalBytes = p.Total()
+	e.FilesPerSec, e.BytesPerSec = p.Rate()
+	if pct := p.Percent(); pct >= 0 {
+		e.Percent = &pct
+	}
+	if eta := p.ETA().Seconds(); eta >= 0 {
+		e.ETA = &eta
+	}
+	l.last = e
+	_ = l.enc.Encode(e)
+}
+
+// error writes an error event.
+func (l *eventLog) error(err error) {
+	e := &errorEvent{Type: "error", Time: time.Now(), Kind: "other", Error: err.Error()}
+	var fe *index.FileError
+	if errors.As(err, &fe) {
+		e.Kind, e.Path = fe.Kind, fe.Path
+	}
+	l.errs++
+	l.kinds[e.Kind]++
+	_ = l.enc.Encode(e)
+}
+
+// close writes the final summary for the specified index file and closes the
+// log. It returns err or any error encountered while closing the log.
+func (l *eventLog) close(name string, err error) error {
+	e := &summaryEvent{
+		Type:       "summary",
+		Time:       time.Now(),
+		Index:      name,
+		OK:         err == nil,
+		FileErrors: l.errs,
+		Progress:   l.last,
+	}
+	var code cli.ExitCode
+	if err != nil && !errors.As(err, &code) {
+		e.Error = err.Error()
+	}
+	if len(l.kinds) > 0 {
+		e.ErrorKinds = l.kinds
+	}
+	err2 := l.enc.Encode(e)
+	if f, ok := l.w.(*os.File); ok && f != os.Stderr {
+		if err3 := f.Close(); err2 == nil {
+			err2 = err3
+		}
+	}
+	if err == nil {
+		err = err2
+	}
+	return err
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package index
 
 import "github.com/mxk/go-cli"
@@ -0,0 +1,294 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os/signal"
+	"slices"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+// scanCfg contains options shared by commands that scan the file system.
+type scanCfg struct {
+	IO        ioCfg
+	Order     index.Order `cli:"Hash files in walk, inode, or extent {order} (inode or extent reduce HDD seeks)"`
+	Precount  bool        `cli:"Count files before hashing to estimate time remaining"`
+	Moves     bool        `cli:"Reuse digests of moved files with matching sizes and modification times"`
+	MoveCheck bool        `cli:"move-check,Compare the first and last chunks of moved files before reusing their digests"`
+	MTime     mtimeFlag   `cli:"mtime,Match modification times within {tolerance} (e.g. fat or window=2s,hours=1,trunc)"`
+	Sum       sumFlag     `cli:"Also compute secondary digests with hash {algorithms} (comma-separated md5, sha1, sha256, crc32, ...)"`
+	Chunk     chunkFlag   `cli:"Split files into content-defined chunks of average {size} to find similar files (e.g. 1MiB)"`
+	Xattr     bool        `cli:"Reuse and store digests cached in extended attributes (Linux)"`
+	Lazy      bool        `cli:"Only hash files that may have copies, comparing same-size files by their first and last 64 KiB"`
+	Events    string      `cli:"Write NDJSON progress and error events to {file} ('-' for stderr)"`
+
+	Retries    int           `cli:"Retry files modified while hashing {n} times before recording them as volatile"`
+	RetryDelay time.Duration `cli:"Wait {interval} before the first retry, doubling it after each attempt"`
+	Checkpoint time.Duration `cli:"Save a partial index every {interval} (0 to disable)"`
+	Resume     bool          `cli:"Resume an interrupted scan from its partial index and settings"`
+
+	hash    index.Algorithm // Hash algorithm of new indexes
+	subtree string          // Only rescan this directory
+	seeded  bool            // Base tree was created from seed indexes
+}
+
+// newScanCfg returns the default scan options.
+func newScanCfg() scanCfg {
+	return scanCfg{Retries: 3, RetryDelay: time.Second, Checkpoint: 10 * time.Minute}
+}
+
+// run scans fsys and saves the resulting index to name. If t is non-nil, only
+// new and modified files are hashed. A partial index is saved periodically and
+// if the scan is interrupted.
+func (c *scanCfg) run(name string, t *index.Tree, fsys fs.FS) (err error) {
+	part := name + ".part"
+	if c.Resume {
+		x, err := index.Load(part)
+		if err != nil {
+			return err
+		}
+		if err = c.restore(x); err != nil {
+			return err
+		}
+		t = x.ToTree()
+	}
+	var m monitor
+	s, err := c.scanner(&m)
+	if err != nil {
+		return err
+	}
+	defer func() { err = m.close(name, err) }()
+
+	// Save partial index on checkpoints and interrupts
+	saved := false
+	s.CheckpointRate = c.Checkpoint
+	s.CheckpointFn = func(x *index.Index) {
+		if err := x.Overwrite(part); err != nil {
+			m.err(fmt.Errorf("failed to save partial index: %w", err))
+		} else {
+			saved = true
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	x, err := s.Rescan(ctx, t, fsys)
+	if err != nil {
+		if ctx.Err() != nil && saved {
+			err = fmt.Errorf("scan interrupted, partial index saved to %s (use -resume to continue)", part)
+		}
+		return err
+	}
+	if err = x.Save(name); err != nil {
+		return err
+	}
+	if c.seeded && m.last != nil {
+		files, bytes := m.last.Reused()
+		log.Printf("Reused %s digests (%s) from seed indexes",
+			humanize.Comma(int64(files)), humanize.IBytes(bytes))
+	}
+	var partial, sparse int
+	var size, alloc int64
+	for _, f := range x.Files() {
+		if f.Flag().IsPartial() {
+			partial++
+		}
+		if a := x.Allocated(f); a < f.Size() {
+			sparse++
+			size += f.Size()
+			alloc += a
+		}
+	}
+	if sparse > 0 {
+		log.Printf("Recorded %d sparse files using %s of %s on disk", sparse,
+			humanize.IBytes(uint64(alloc)), humanize.IBytes(uint64(size)))
+	}
+	if partial > 0 {
+		log.Printf("Recorded %d unique files with partial digests (update without -lazy will fully hash them)", partial)
+	}
+	var volatile int
+	for _, e := range x.Errors() {
+		if e.Kind == index.ModifiedErr {
+			volatile++
+		}
+	}
+	if volatile > 0 {
+		log.Printf("Recorded %d volatile files that were modified while hashing", volatile)
+	}
+	if n := len(x.Errors()) - volatile; n > 0 {
+		log.Printf("Recorded %d paths that could not be indexed (update will retry them)", n)
+	}
+	if err = index.Remove(part); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if m.walkErr {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
+
+// restore sets the scan options from the partial index x of an interrupted
+// scan. Options that were set explicitly must match those of x.
+func (c *scanCfg) restore(x *index.Index) error {
+	if c.MTime.set && c.MTime.TimeTolerance != x.MTime() {
+		return cli.Errorf("-mtime %v does not match the partial index (%v)", c.MTime.TimeTolerance, x.MTime())
+	}
+	if c.Sum.set && !slices.Equal(c.Sum.algs, x.Secondary()) {
+		return cli.Errorf("-sum %v does not match the partial index (%v)", &c.Sum, index.FormatAlgorithms(x.Secondary()))
+	}
+	if c.Chunk.set && int(c.Chunk.byteSize) != x.ChunkSize() {
+		return cli.Errorf("-chunk %v does not match the partial index (%v)", c.Chunk.byteSize, byteSize(x.ChunkSize()))
+	}
+	c.hash = x.Hash()
+	c.MTime.TimeTolerance = x.MTime()
+	c.Sum.algs = x.Secondary()
+	c.Chunk.byteSize = byteSize(x.ChunkSize())
+	return nil
+}
+
+// scanner returns a new index scanner that reports errors and progress to m.
+func (c *scanCfg) scanner(m *monitor) (*index.Scanner, error) {
+	s, err := c.IO.scanner(m)
+	if err != nil {
+		return nil, err
+	}
+	if c.Events != "" {
+		if m.events, err = openEventLog(c.Events); err != nil {
+			return nil, err
+		}
+	}
+	s.Order = c.Order
+	s.Precount = c.Precount
+	s.Moves = c.Moves
+	s.MoveCheck = c.MoveCheck
+	s.MTime = c.MTime.TimeTolerance
+	s.Hash = c.hash
+	s.Secondary = c.Sum.algs
+	s.ChunkSize = int(c.Chunk.byteSize)
+	s.XattrCache = c.Xattr
+	s.Lazy = c.Lazy
+	s.Retries = c.Retries
+	s.RetryDelay = c.RetryDelay
+	s.Subtree = c.subtree
+	return s, nil
+}
+
+// ioCfg contains options that limit the impact of hashing on other processes.
+type ioCfg struct {
+	Rate    byteSize         `cli:"Limit total hashing throughput to {bytes} per second (e.g. 50MiB)"`
+	IOPrio  index.IOPriority `cli:"Set I/O scheduling {priority} to normal, low, or idle (Linux)"`
+	NoCache bool             `cli:"Evict file data from the page cache after hashing (Linux)"`
+}
+
+// scanner applies the I/O priority and returns a new index scanner that
+// reports errors and progress to m.
+func (c *ioCfg) scanner(m *monitor) (*index.Scanner, error) {
+	if err := c.IOPrio.Apply(); err != nil {
+		return nil, err
+	}
+	return &index.Scanner{
+		ErrFn:   m.err,
+		ProgFn:  m.report,
+		Rate:    uint64(c.Rate),
+		NoCache: c.NoCache,
+	}, nil
+}
+
+// mtimeFlag is a modification time tolerance flag that records whether it was
+// set explicitly.
+type mtimeFlag struct {
+	index.TimeTolerance
+	set bool
+}
+
+func (f *mtimeFlag) Set(s string) error {
+	f.set = true
+	return f.TimeTolerance.Set(s)
+}
+
+// sumFlag is a list of secondary hash algorithms that records whether it was
+// set explicitly.
+type sumFlag struct {
+	algs []index.Algorithm
+	set  bool
+}
+
+func (f *sumFlag) String() string { return index.FormatAlgorithms(f.algs) }
+
+func (f *sumFlag) Set(s string) (err error) {
+	f.algs, err = index.ParseAlgorithms(s)
+	f.set = true
+	return
+}
+
+// chunkFlag is an average chunk size that records whether it was set
+// explicitly.
+type chunkFlag struct {
+	byteSize
+	set bool
+}
+
+func (f *chunkFlag) Set(s string) error {
+	f.set = true
+	return f.byteSize.Set(s)
+}
+
+// byteSize is a flag.Value that accepts human-readable byte counts.
+type byteSize uint64
+
+func (b byteSize) String() string { return humanize.IBytes(uint64(b)) }
+
+func (b *byteSize) Set(s string) error {
+	v, err := humanize.ParseBytes(s)
+	*b = byteSize(v)
+	return err
+}
+
+type monitor struct {
+	walkErr    bool
+	nextReport time.Duration
+	events     *eventLog
+	last       *index.Progress
+}
+
+// err reports a scan error. Notices are logged without affecting the exit
+// status.
+func (m *monitor) err(err error) {
+	if n := (*index.Notice)(nil); errors.As(err, &n) {
+		log.Println(err)
+		return
+	}
+	m.walkErr = true
+	log.Println(err)
+	if m.events != nil {
+		m.events.error(err)
+	}
+}
+
+func (m *monitor) report(p *index.Progress) {
+	m.last = p
+	const rate = 5 * time.Minute
+	if p.Duration() >= max(time.Minute, m.nextReport) || p.IsFinal() {
+		log.Println(p)
+		m.nextReport = (p.Duration() + rate).Round(rate)
+	}
+	if m.events != nil {
+		m.events.progress(p)
+	}
+}
+
+// close writes the event log summary for the specified index file. It returns
+// err or any error encountered while closing the log.
+func (m *monitor) close(name string, err error) error {
+	if m.events == nil {
+		return err
+	}
+	return m.events.close(name, err)
+}
@@ -0,0 +1,86 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "sidecars",
+	Usage:   "<index>",
+	Summary: "Check files against sidecar checksum files found in the tree",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &sidecarsCmd{} },
+})
+
+type sidecarsCmd struct {
+	IO   ioCfg
+	Root string `cli:"Change root directory"`
+}
+
+func (*sidecarsCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Find checksum files produced by other tools in the index and check the files
+	that they list. Supported checksum files are B3SUMS, MD5SUMS, SHA1SUMS, and
+	SHA256SUMS (with an optional .txt extension), and files with .b3, .md5,
+	.sfv, .sha1, or .sha256 extensions. Listed names are relative to the
+	directory of the checksum file.
+
+	Digests are taken from the index when possible. To avoid reading files
+	again, create or update the index with the secondary digests used by the
+	checksum files (e.g. -sum md5,sha1,sha256,crc32). All other listed files
+	are hashed.
+
+	Files that do not match are reported as MISMATCH. Listed files that are not
+	in the index or cannot be read are reported as MISSING.
+	`)
+}
+
+func (cmd *sidecarsCmd) Main(args []string) error {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.Root == "" {
+		cmd.Root = x.Root()
+	}
+	if _, err := os.Stat(cmd.Root); err != nil {
+		return err
+	}
+	var m monitor
+	s, err := cmd.IO.scanner(&m)
+	if err != nil {
+		return err
+	}
+	s.MTime = x.MTime()
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	c, err := s.CheckSidecars(ctx, x.ToTree(), os.DirFS(cmd.Root))
+	if err != nil {
+		return err
+	}
+	for _, e := range c.Mismatch {
+		fmt.Printf("MISMATCH\t%s\t(%s in %s)\n", e.Path, e.Alg, e.Sidecar)
+	}
+	for _, e := range c.Missing {
+		fmt.Printf("MISSING\t%s\t(%s)\n", e.Path, e.Sidecar)
+	}
+	log.Printf("Checked %d files listed in %d checksum files: %d matched, %d mismatched, %d missing",
+		len(c.Matched)+len(c.Mismatch)+len(c.Missing), len(c.Sidecars),
+		len(c.Matched), len(c.Mismatch), len(c.Missing))
+	if c.Invalid > 0 {
+		log.Printf("Skipped %d improperly formatted lines", c.Invalid)
+	}
+	if len(c.Mismatch) > 0 || len(c.Missing) > 0 || m.walkErr {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
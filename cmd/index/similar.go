@@ -0,0 +1,82 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "similar",
+	Usage:   "<index>",
+	Summary: "Find near-duplicate files and estimate chunk-level deduplication savings",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &similarCmd{Min: 0.5} },
+})
+
+type similarCmd struct {
+	Min   float64 `cli:"Minimum shared chunk {ratio} for a pair of files to be reported"`
+	Quiet bool    `cli:"Only print the deduplication estimate"`
+}
+
+func (*similarCmd) Help(w *cli.Writer) {
+	w.Text(`
+	List pairs of files with different contents that share content-defined
+	chunks, such as VM images or databases that differ by a few blocks. Each
+	line shows the ratio of shared chunks, the shared size, and both paths. The
+	ratio is the size of the chunks that are in both files divided by the size
+	of the chunks that are in either file.
+
+	A summary on stderr compares the total size of all files to the space that
+	would be required with whole-file and chunk-level deduplication, which is
+	an estimate of what a content-addressed backup tool, such as Kopia, would
+	store before compression.
+
+	The index must be created or updated with the -chunk option. Chunks are
+	stored in a separate file next to the index with a ".chunks" extension.
+	`)
+}
+
+func (cmd *similarCmd) Main(args []string) error {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if x.ChunkSize() == 0 {
+		return cli.Error("index does not contain chunks (update with -chunk to compute them)")
+	}
+	t := x.ToTree()
+	if !cmd.Quiet {
+		w := bufio.NewWriter(os.Stdout)
+		for _, s := range t.Similar(cmd.Min) {
+			_, _ = fmt.Fprintf(w, "%5.1f%%\t%s\t%s\t%s\n", 100*s.Ratio,
+				humanize.IBytes(uint64(s.Shared)), s.A, s.B)
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+	}
+	s := t.ChunkStats()
+	pct := func(n int64) float64 {
+		if s.Size == 0 {
+			return 0
+		}
+		return 100 * float64(s.Size-n) / float64(s.Size)
+	}
+	log.Printf("%s files using %s", humanize.Comma(int64(s.Files)), humanize.IBytes(uint64(s.Size)))
+	log.Printf("Whole-file deduplication: %s (%.1f%% saved)", humanize.IBytes(uint64(s.FileDedup)), pct(s.FileDedup))
+	log.Printf("Chunk-level deduplication: %s in %s chunks of %s average size (%.1f%% saved)",
+		humanize.IBytes(uint64(s.ChunkDedup)), humanize.Comma(int64(s.Chunks)),
+		humanize.IBytes(uint64(x.ChunkSize())), pct(s.ChunkDedup))
+	if s.Unchunked > 0 {
+		log.Printf("Counted %d unique files without chunks as whole files (update to compute them)", s.Unchunked)
+	}
+	return nil
+}
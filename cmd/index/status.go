@@ -0,0 +1,77 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "status|st",
+	Usage:   "<index>",
+	Summary: "Show changes since the index was updated without hashing",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &statusCmd{} },
+})
+
+type statusCmd struct {
+	Root  string `cli:"Change root directory"`
+	Quiet bool   `cli:"Only print the summary"`
+}
+
+func (*statusCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Compare file sizes and modification times to the index and list new (A),
+	modified (M), deleted (D), and type-changed (T) paths, followed by a summary
+	on stderr. The exit code is 1 if the index is stale.
+	`)
+}
+
+func (cmd *statusCmd) Main(args []string) error {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.Root == "" {
+		cmd.Root = x.Root()
+	}
+	if _, err := os.Stat(cmd.Root); err != nil {
+		return err
+	}
+	var m monitor
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	all, err := x.ToTree().Status(ctx, os.DirFS(cmd.Root), m.err)
+	if err != nil {
+		return err
+	}
+	var count [index.TypeChanged + 1]int
+	var bytes [index.TypeChanged + 1]uint64
+	w := bufio.NewWriter(os.Stdout)
+	for _, c := range all {
+		count[c.Kind]++
+		bytes[c.Kind] += uint64(c.Size)
+		if !cmd.Quiet {
+			_, _ = fmt.Fprintf(w, "%c  %s\n", "?AMDT"[c.Kind], c.Path)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	for k := index.Added; k <= index.TypeChanged; k++ {
+		log.Printf("%s: %s files (%s)", k, humanize.Comma(int64(count[k])), humanize.IBytes(bytes[k]))
+	}
+	if len(all) > 0 || m.walkErr {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package index
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "import-sums",
+	Usage:   "<index> <manifest> [root]",
+	Summary: "Create an index from a b3sum or sha256sum manifest",
+	MinArgs: 2,
+	MaxArgs: 3,
+	New:     func() cli.Cmd { return &importSumsCmd{} },
+})
+
+type importSumsCmd struct {
+	Hash    index.Algorithm `cli:"Manifest hash {algorithm} (blake3, sha256, or sha512/256)"`
+	NoMTime bool            `cli:"no-mtime,Leave modification times unknown instead of reading them from the file system"`
+}
+
+func (*importSumsCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Create a new index from a manifest written by b3sum, sha256sum, or
+	'fsx hash -sum'. A manifest name of '-' reads standard input.
+
+	Manifest file names must be relative to the root directory, which defaults
+	to the directory containing the manifest. File sizes and modification times
+	are read from the file system, trusting that the files were not modified
+	since the manifest was created. With -no-mtime, modification times are left
+	unknown, so the next update hashes all files again. Use 'index verify' to
+	check the imported digests.
+	`)
+}
+
+func (cmd *importSumsCmd) Main(args []string) error {
+	if !cmd.Hash.IsPrimary() {
+		return cli.Errorf("not a primary hash algorithm: %v", cmd.Hash)
+	}
+	var root string
+	if len(args) > 2 {
+		root = args[2]
+	} else if args[1] != "-" {
+		root = filepath.Dir(args[1])
+	} else {
+		return cli.Error("root directory is required when reading from stdin")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	var all []index.ManifestEntry
+	var invalid int
+	if args[1] == "-" {
+		all, invalid, err = index.ReadManifest(os.Stdin)
+	} else {
+		var f *os.File
+		if f, err = os.Open(args[1]); err != nil {
+			return err
+		}
+		all, invalid, err = index.ReadManifest(f)
+		_ = f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if filepath.IsAbs(all[i].Name) {
+			if rel, err := filepath.Rel(root, all[i].Name); err == nil {
+				all[i].Name = rel
+			}
+		}
+	}
+	var m monitor
+	x := index.FromManifest(os.DirFS(root), all, cmd.Hash, !cmd.NoMTime, m.err)
+	if err = x.Save(args[0]); err != nil {
+		return err
+	}
+	log.Printf("Imported %d of %d manifest entries", len(x.Files()), len(all))
+	if invalid > 0 {
+		log.Printf("Skipped %d improperly formatted lines", invalid)
+	}
+	if m.walkErr || invalid > 0 {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "export-sums",
+	Usage:   "<index> [manifest]",
+	Summary: "Write index digests as a b3sum or sha256sum manifest",
+	MinArgs: 1,
+	MaxArgs: 2,
+	New:     func() cli.Cmd { return &exportSumsCmd{} },
+})
+
+type exportSumsCmd struct {
+	Hash string `cli:"Export primary or secondary digests of hash {algorithm} (default is the index algorithm)"`
+}
+
+func (*exportSumsCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Write the digests of all existing files in the index as a manifest that can
+	be checked with b3sum -c, sha256sum -c, md5sum -c, or 'fsx hash -check'.
+	The manifest is written to stdout unless a file name is specified. File
+	names are relative to the index root, so the check must be run from there.
+
+	Secondary digests, such as md5 or sha1, can be exported if they were
+	computed with the -sum option. Files with partial digests are skipped.
+	`)
+}
+
+func (cmd *exportSumsCmd) Main(args []string) (err error) {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	alg := x.Hash()
+	if cmd.Hash != "" {
+		if err = alg.Set(cmd.Hash); err != nil {
+			return err
+		}
+	}
+	w := os.Stdout
+	if len(args) > 1 {
+		if w, err = os.Create(args[1]); err != nil {
+			return err
+		}
+		defer func() {
+			if err2 := w.Close(); err == nil {
+				err = err2
+			}
+		}()
+	}
+	skipped, err := x.WriteManifest(w, alg)
+	if err == nil && skipped > 0 {
+		log.Printf("Skipped %d files without %v digests", skipped, alg)
+	}
+	return err
+}
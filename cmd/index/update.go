@@ -1,7 +1,6 @@
 package index
 
 import (
-	"context"
 	"os"
 
 	"github.com/mxk/go-cli"
@@ -15,11 +14,13 @@ var _ = indexCli.Add(&cli.Cfg{
 	Summary: "Update file system index",
 	MinArgs: 1,
 	MaxArgs: 1,
-	New:     func() cli.Cmd { return &updateCmd{} },
+	New:     func() cli.Cmd { return &updateCmd{Scan: newScanCfg()} },
 })
 
 type updateCmd struct {
 	Root string `cli:"Change root directory"`
+	Path string `cli:"Only rescan the {dir} subtree, keeping all other entries as they are"`
+	Scan scanCfg
 }
 
 func (cmd *updateCmd) Main(args []string) error {
@@ -33,13 +34,16 @@ func (cmd *updateCmd) Main(args []string) error {
 	if _, err := os.Stat(cmd.Root); err != nil {
 		return err
 	}
-	var m monitor
-	x, err = x.ToTree().Rescan(context.Background(), os.DirFS(cmd.Root), m.err, m.report)
-	if err != nil {
-		return err
+	if !cmd.Scan.MTime.set {
+		cmd.Scan.MTime.TimeTolerance = x.MTime()
+	}
+	if !cmd.Scan.Sum.set {
+		cmd.Scan.Sum.algs = x.Secondary()
 	}
-	if err = x.Save(args[0]); err == nil && m.walkErr {
-		err = cli.ExitCode(1)
+	if !cmd.Scan.Chunk.set {
+		cmd.Scan.Chunk.byteSize = byteSize(x.ChunkSize())
 	}
-	return err
+	cmd.Scan.hash = x.Hash()
+	cmd.Scan.subtree = cmd.Path
+	return cmd.Scan.run(args[0], x.ToTree(), os.DirFS(cmd.Root))
 }
@@ -0,0 +1,101 @@
+package index
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "verify|v",
+	Usage:   "<index>",
+	Summary: "Detect silent data corruption in unmodified files",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &verifyCmd{Sample: 100} },
+})
+
+type verifyCmd struct {
+	IO        ioCfg
+	Root      string        `cli:"Change root directory"`
+	Sample    float64       `cli:"Verify {percent} of files, selected by the current date"`
+	OlderThan time.Duration `cli:"Only verify files last modified more than {duration} ago"`
+}
+
+func (*verifyCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Re-hash files whose size and modification time match the index and report
+	any whose contents have changed as corrupt. Modified and removed files are
+	skipped. For each corrupt file, other copies with the same digest are
+	checked and any intact ones are listed.
+
+	The -sample option divides files into ceil(100/percent) slices by digest and
+	selects one slice based on the current date. Running verify daily with
+	-sample 5 checks every file once every 20 days.
+	`)
+}
+
+func (cmd *verifyCmd) Main(args []string) error {
+	if !(0 < cmd.Sample && cmd.Sample <= 100) {
+		return cli.Error("sample percentage must be in the range (0,100]")
+	}
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.Root == "" {
+		cmd.Root = x.Root()
+	}
+	if _, err := os.Stat(cmd.Root); err != nil {
+		return err
+	}
+	var m monitor
+	s, err := cmd.IO.scanner(&m)
+	if err != nil {
+		return err
+	}
+	s.MTime = x.MTime()
+	s.Hash = x.Hash()
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	v, err := s.Verify(ctx, x.ToTree(), os.DirFS(cmd.Root), cmd.selector(time.Now()))
+	if err != nil {
+		return err
+	}
+	for _, c := range v.Corrupt {
+		fmt.Printf("CORRUPT\t%s\n", c)
+		if len(c.Intact) == 0 {
+			fmt.Println("\tno intact copies")
+		}
+		for _, f := range c.Intact {
+			fmt.Printf("\tintact copy: %s\n", f)
+		}
+	}
+	log.Printf("Verified %d files, skipped %d modified or removed, found %d corrupt",
+		len(v.Verified), len(v.Changed), len(v.Corrupt))
+	if len(v.Corrupt) > 0 || m.walkErr {
+		return cli.ExitCode(1)
+	}
+	return nil
+}
+
+// selector returns the function that selects files to verify.
+func (cmd *verifyCmd) selector(now time.Time) func(*index.File) bool {
+	n := uint64(math.Ceil(100 / cmd.Sample))
+	slice := uint64(now.Unix()/(24*60*60)) % n
+	cutoff := now.Add(-cmd.OlderThan)
+	return func(f *index.File) bool {
+		d := f.Digest()
+		return binary.LittleEndian.Uint64(d[:8])%n == slice &&
+			(cmd.OlderThan <= 0 || f.ModTime().Before(cutoff))
+	}
+}
@@ -0,0 +1,90 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mxk/go-cli"
+
+	"github.com/mxk/fsx/index"
+)
+
+var _ = indexCli.Add(&cli.Cfg{
+	Name:    "watch|w",
+	Usage:   "<index>",
+	Summary: "Keep file system index updated using change notifications",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New: func() cli.Cmd {
+		return &watchCmd{Delay: 5 * time.Second, Save: 5 * time.Minute, Retries: 3, RetryDelay: time.Second}
+	},
+})
+
+type watchCmd struct {
+	Root  string `cli:"Change root directory"`
+	IO    ioCfg
+	Delay time.Duration `cli:"Wait for files to remain unchanged for {interval} before hashing"`
+	Save  time.Duration `cli:"Save the index at most once per {interval}"`
+
+	Retries    int           `cli:"Retry files modified while hashing {n} times before recording them as volatile"`
+	RetryDelay time.Duration `cli:"Wait {interval} before the first retry, doubling it after each attempt"`
+}
+
+func (*watchCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Update the index, then monitor the root directory for changes using inotify
+	and rehash only the files that were modified. The index is saved
+	periodically and when the command is interrupted. If the kernel event queue
+	overflows, the entire tree is rescanned. Files that are still being
+	modified after all retries are recorded as volatile until they change
+	again.
+
+	Linux only.
+	`)
+}
+
+func (cmd *watchCmd) Main(args []string) error {
+	x, err := index.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.Root == "" {
+		cmd.Root = x.Root()
+	}
+	if _, err := os.Stat(cmd.Root); err != nil {
+		return err
+	}
+	var m monitor
+	s, err := cmd.IO.scanner(&m)
+	if err != nil {
+		return err
+	}
+	s.MTime = x.MTime()
+	s.Hash = x.Hash()
+	s.Secondary = x.Secondary()
+	s.ChunkSize = x.ChunkSize()
+	s.Retries = cmd.Retries
+	s.RetryDelay = cmd.RetryDelay
+	w := index.Watcher{
+		Scanner: *s,
+		SaveFn: func(x *index.Index) {
+			if err := x.Overwrite(args[0]); err != nil {
+				m.err(fmt.Errorf("failed to save index: %w", err))
+			}
+		},
+		SaveRate: cmd.Save,
+		Delay:    cmd.Delay,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), cli.ExitSignals()...)
+	defer stop()
+	log.Printf("Watching %s", cmd.Root)
+	if err = w.Watch(ctx, x, cmd.Root); errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
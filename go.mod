@@ -10,6 +10,8 @@ require (
 	github.com/rivo/uniseg v0.4.4
 	github.com/stretchr/testify v1.8.4
 	github.com/zeebo/blake3 v0.2.3
+	golang.org/x/sys v0.15.0
+	lukechampine.com/blake3 v1.3.0
 )
 
 require (
@@ -17,6 +19,5 @@ require (
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.6 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.15.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// Algorithm is the hash function used to compute file digests. Only algorithms
+// that produce 256-bit digests can be used as the primary algorithm. Others are
+// only used for secondary digests.
+type Algorithm uint8
+
+const (
+	BLAKE3     Algorithm = iota // BLAKE3-256 (default)
+	SHA256                      // SHA-256
+	SHA512_256                  // SHA-512/256
+	MD5                         // MD5 (secondary only)
+	SHA1                        // SHA-1 (secondary only)
+	CRC32                       // CRC-32 (IEEE) used by SFV files (secondary only)
+)
+
+var algNames = [...]string{
+	BLAKE3:     "blake3",
+	SHA256:     "sha256",
+	SHA512_256: "sha512/256",
+	MD5:        "md5",
+	SHA1:       "sha1",
+	CRC32:      "crc32",
+}
+
+// String returns the algorithm name.
+func (a Algorithm) String() string {
+	if int(a) < len(algNames) {
+		return algNames[a]
+	}
+	return fmt.Sprintf("Algorithm(%d)", a)
+}
+
+// Set sets the algorithm from its name, ignoring case.
+func (a *Algorithm) Set(s string) error {
+	for i, name := range algNames {
+		if strings.EqualFold(s, name) {
+			*a = Algorithm(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("index: unsupported hash algorithm: %q", s)
+}
+
+// IsPrimary returns whether a can be used to compute primary file digests.
+func (a Algorithm) IsPrimary() bool {
+	return int(a) < len(algNames) && a.size() == len(Digest{})
+}
+
+// NewHasher returns a new file hasher that uses primary algorithm a. See
+// NewHasher for more info.
+func (a Algorithm) NewHasher(monitor func(n int) error) *Hasher {
+	if !a.IsPrimary() {
+		panic(fmt.Sprint("index: not a primary hash algorithm: ", a))
+	}
+	return &Hasher{h: a.new(), alg: a, m: monitor}
+}
+
+// new creates new hash state.
+func (a Algorithm) new() hash.Hash {
+	switch a {
+	case BLAKE3:
+		return blake3.New()
+	case SHA256:
+		return sha256.New()
+	case SHA512_256:
+		return sha512.New512_256()
+	case MD5:
+		return md5.New()
+	case SHA1:
+		return sha1.New()
+	case CRC32:
+		return crc32.NewIEEE()
+	}
+	panic(fmt.Sprint("index: invalid hash algorithm: ", a))
+}
+
+// size returns the digest size in bytes.
+func (a Algorithm) size() int { return a.new().Size() }
+
+// ParseAlgorithms parses a comma-separated list of algorithm names.
+func ParseAlgorithms(s string) ([]Algorithm, error) {
+	var algs []Algorithm
+	for _, name := range strings.Split(s, ",") {
+		var a Algorithm
+		if err := a.Set(name); err != nil {
+			return nil, err
+		}
+		algs = append(algs, a)
+	}
+	return algs, nil
+}
+
+// FormatAlgorithms returns a comma-separated list of algorithm names.
+func FormatAlgorithms(algs []Algorithm) string {
+	names := make([]string, len(algs))
+	for i, a := range algs {
+		names[i] = a.String()
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,357 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Chunk is a content-defined chunk of a file.
+type Chunk struct {
+	Digest Digest // Digest of chunk contents using the index hash algorithm
+	Size   int64  // Chunk size in bytes
+}
+
+// Chunk size limits. The minimum and maximum chunk sizes are 1/4 and 8 times
+// the average size, as recommended by the FastCDC paper.
+const (
+	MinChunkSize = 4 * 1024
+	MaxChunkSize = 64 * 1024 * 1024
+)
+
+// validChunkSize returns an error if avg is not a valid average chunk size.
+// Zero disables chunking.
+func validChunkSize(avg int) error {
+	if avg != 0 && (avg < MinChunkSize || avg > MaxChunkSize || avg&(avg-1) != 0) {
+		return fmt.Errorf("index: invalid average chunk size: %d (must be a power of two between %d and %d)",
+			avg, MinChunkSize, MaxChunkSize)
+	}
+	return nil
+}
+
+// chunkMin returns the minimum chunk size for the average size avg. Files
+// smaller than this consist of a single chunk with the same digest as the file.
+func chunkMin(avg int) int64 { return int64(avg) / 4 }
+
+// gear is the FastCDC gear table. It is generated by a fixed splitmix64
+// sequence and must never change because stored chunk digests depend on it.
+var gear = func() (t [256]uint64) {
+	x := uint64(0x66737820_63686e6b) // "fsx chnk"
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+	return
+}()
+
+// chunker splits a stream into content-defined chunks using FastCDC with
+// normalized chunking. A stricter mask is used before the average size and a
+// looser one after it, which narrows the chunk size distribution. The gear
+// hash is only updated after the minimum size, so chunk boundaries do not
+// depend on how the stream is split into writes.
+type chunker struct {
+	min, avg, max int64
+	maskS, maskL  uint64 // Masks before and after the average size
+	h             hash.Hash
+	fp            uint64 // Gear fingerprint
+	n             int64  // Size of the current chunk
+	all           []Chunk
+}
+
+// newChunker returns a chunker with the specified average chunk size that
+// computes chunk digests with alg.
+func newChunker(alg Algorithm, avg int) *chunker {
+	b := bits.TrailingZeros(uint(avg))
+	mask := func(n int) uint64 { return ^uint64(0) << (64 - n) } // Top n bits
+	return &chunker{
+		min:   chunkMin(avg),
+		avg:   int64(avg),
+		max:   int64(avg) * 8,
+		maskS: mask(b + 2),
+		maskL: mask(b - 2),
+		h:     alg.new(),
+	}
+}
+
+// reset discards all chunks.
+func (c *chunker) reset() {
+	c.h.Reset()
+	c.fp, c.n, c.all = 0, 0, c.all[:0]
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i, cut := c.next(p)
+		_, _ = c.h.Write(p[:i])
+		if p = p[i:]; cut {
+			c.cut()
+		}
+	}
+	return n, nil
+}
+
+// next returns the number of bytes of p that belong to the current chunk and
+// whether the chunk ends there.
+func (c *chunker) next(p []byte) (int, bool) {
+	i := 0
+	if c.n < c.min {
+		i = int(min(c.min-c.n, int64(len(p))))
+		c.n += int64(i)
+	}
+	fp := c.fp
+	for ; i < len(p); i++ {
+		fp = fp<<1 + gear[p[i]]
+		c.n++
+		mask := c.maskL
+		if c.n < c.avg {
+			mask = c.maskS
+		}
+		if fp&mask == 0 || c.n >= c.max {
+			c.fp = fp
+			return i + 1, true
+		}
+	}
+	c.fp = fp
+	return i, false
+}
+
+// cut ends the current chunk.
+func (c *chunker) cut() {
+	k := Chunk{Size: c.n}
+	if b := c.h.Sum(k.Digest[:0]); &b[len(b)-1] != &k.Digest[len(k.Digest)-1] {
+		panic("index: digest buffer reallocated")
+	}
+	c.all = append(c.all, k)
+	c.h.Reset()
+	c.fp, c.n = 0, 0
+}
+
+// chunks ends the final chunk and returns a copy of all chunks.
+func (c *chunker) chunks() []Chunk {
+	if c.n > 0 {
+		c.cut()
+	}
+	return append([]Chunk(nil), c.all...)
+}
+
+// setChunks configures the Hasher to split files into content-defined chunks
+// with the specified average size. Like secondary digests, this requires
+// reading file contents sequentially.
+func (h *Hasher) setChunks(avg int) {
+	if avg == 0 {
+		h.chunks = nil
+	} else {
+		h.chunks = newChunker(h.alg, avg)
+	}
+}
+
+// Chunks returns the content-defined chunks of the last file that was read or
+// nil if chunking is disabled.
+func (h *Hasher) Chunks() []Chunk { return h.lastChunks }
+
+// ChunkSize returns the average chunk size used to split files into chunks or
+// zero if chunking is disabled.
+func (x *Index) ChunkSize() int { return x.chunkSize }
+
+// Chunks returns the content-defined chunks of file f or nil if they are not
+// known. Files smaller than the minimum chunk size consist of a single chunk
+// with the file digest.
+func (x *Index) Chunks(f *File) []Chunk { return fileChunks(f, x.chunks, x.chunkSize) }
+
+// fileChunks returns the chunks of file f from all, which were computed with
+// average chunk size avg.
+func fileChunks(f *File, all map[Digest][]Chunk, avg int) []Chunk {
+	switch {
+	case avg == 0 || f.size == 0 || f.flag.IsPartial():
+		return nil
+	case f.size < chunkMin(avg):
+		return []Chunk{{f.digest, f.size}}
+	}
+	return all[f.digest]
+}
+
+// setChunks sets the chunks of all files in x, looking up each digest in srcs
+// in order.
+func (x *Index) setChunks(srcs ...map[Digest][]Chunk) {
+	x.chunks = nil
+	if x.chunkSize == 0 {
+		return
+	}
+	for _, g := range x.groups {
+		if g[0].flag.IsPartial() || g[0].size < chunkMin(x.chunkSize) {
+			continue
+		}
+		for _, src := range srcs {
+			if c := src[g[0].digest]; c != nil {
+				if x.chunks == nil {
+					x.chunks = make(map[Digest][]Chunk)
+				}
+				x.chunks[g[0].digest] = c
+				break
+			}
+		}
+	}
+}
+
+// hasChunks returns whether the chunks of file f computed with average chunk
+// size avg are known.
+func (t *Tree) hasChunks(f *File, avg int) bool {
+	return avg == 0 || f.size < chunkMin(avg) || t.csize == avg && t.chunks[f.digest] != nil
+}
+
+// addChunks records the chunks of file f.
+func (w *walker) addChunks(f *File, c []Chunk) {
+	if c != nil && f.size >= chunkMin(w.ChunkSize) {
+		w.mu.Lock()
+		if w.chunks == nil {
+			w.chunks = make(map[Digest][]Chunk)
+		}
+		w.chunks[f.digest] = c
+		w.mu.Unlock()
+	}
+}
+
+// takeChunks removes and returns the recorded chunks of the file with digest d.
+func (w *walker) takeChunks(d Digest) ([]Chunk, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.chunks[d]
+	delete(w.chunks, d)
+	return c, ok
+}
+
+// setChunks sets the chunks of all files in x from those recorded by the walker
+// and the base tree t, which may be nil. Chunks in t are only used if they were
+// computed with the same average chunk size.
+func (w *walker) setChunks(x *Index, t *Tree) {
+	var base map[Digest][]Chunk
+	if t != nil && t.csize == x.chunkSize {
+		base = t.chunks
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	x.setChunks(w.chunks, base)
+}
+
+// chunksName returns the name of the file that stores the chunks of index
+// file name.
+func chunksName(name string) string { return name + ".chunks" }
+
+// Remove removes index file name and its chunks file, if any.
+func Remove(name string) error {
+	err := os.Remove(chunksName(name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(name)
+}
+
+const chunksV1 = "fsx chunks v1"
+
+// loadChunks loads chunks computed with average chunk size avg from the
+// specified file. It returns nil if the file does not exist or was written
+// with a different chunk size, in which case the chunks are computed again by
+// the next update.
+func loadChunks(name string, avg int) (map[Digest][]Chunk, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	r, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	all, size, err := readChunks(r)
+	if size != avg {
+		all = nil
+	}
+	return all, err
+}
+
+// readChunks reads uncompressed chunks from src. It returns the average chunk
+// size that was used to compute them.
+func readChunks(src io.Reader) (all map[Digest][]Chunk, avg int, err error) {
+	s := bufio.NewScanner(src)
+	if !s.Scan() || s.Text() != chunksV1 {
+		return nil, 0, fmt.Errorf("index: invalid chunks signature")
+	}
+	if !s.Scan() {
+		return nil, 0, fmt.Errorf("index: missing chunk size")
+	}
+	v, ok := strings.CutPrefix(s.Text(), "@size ")
+	if avg, err = strconv.Atoi(v); !ok || err != nil || validChunkSize(avg) != nil || avg == 0 {
+		return nil, 0, fmt.Errorf("index: invalid chunk size: %s", s.Text())
+	}
+	all = make(map[Digest][]Chunk)
+	var cur *Digest
+	for line := 3; s.Scan(); line++ {
+		ln, isChunk := bytes.CutPrefix(s.Bytes(), []byte("\t"))
+		d, size, _ := cutByte(ln, '\t')
+		var k Chunk
+		if n, err := hex.Decode(k.Digest[:], d[:min(len(d), 2*len(Digest{}))]); err != nil || n != len(Digest{}) || len(d) != 2*n {
+			return nil, 0, fmt.Errorf("index: invalid digest on chunks line %d", line)
+		}
+		if !isChunk {
+			cur = &k.Digest
+			continue
+		}
+		v, err := strconv.ParseUint(unsafeString(size), 10, 63)
+		if k.Size = int64(v); err != nil || v == 0 || cur == nil {
+			return nil, 0, fmt.Errorf("index: invalid chunk on line %d", line)
+		}
+		all[*cur] = append(all[*cur], k)
+	}
+	if s.Err() != nil {
+		return nil, 0, fmt.Errorf("index: chunks read error (%w)", s.Err())
+	}
+	return all, avg, nil
+}
+
+// writeChunks writes the chunks of all files in x to dst.
+func (x *Index) writeChunks(dst io.Writer) error {
+	w, err := zstd.NewWriter(dst)
+	if err != nil {
+		panic(err) // Invalid option(s)
+	}
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "%s\n@size %d\n", chunksV1, x.chunkSize)
+	b := make([]byte, 0, 128)
+	for _, g := range x.groups {
+		c := x.chunks[g[0].digest]
+		if c == nil || g[0].flag.IsPartial() {
+			continue
+		}
+		b = append(append(b[:0], hex.EncodeToString(g[0].digest[:])...), '\n')
+		_, _ = bw.Write(b)
+		for _, k := range c {
+			b = append(b[:0], '\t')
+			b = append(append(b, hex.EncodeToString(k.Digest[:])...), '\t')
+			b = append(strconv.AppendInt(b, k.Size, 10), '\n')
+			_, _ = bw.Write(b)
+		}
+	}
+	if err = bw.Flush(); err == nil {
+		err = w.Close()
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunker(t *testing.T) {
+	const avg = MinChunkSize
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	split := func(step int) []Chunk {
+		c := newChunker(BLAKE3, avg)
+		c.reset()
+		for p := data; len(p) > 0; p = p[min(step, len(p)):] {
+			_, _ = c.Write(p[:min(step, len(p))])
+		}
+		return c.chunks()
+	}
+	want := split(len(data))
+	assert.Equal(t, want, split(1000))
+	assert.Equal(t, want, split(1))
+
+	var n int64
+	for i, k := range want {
+		assert.LessOrEqual(t, k.Size, int64(8*avg))
+		if i < len(want)-1 {
+			assert.GreaterOrEqual(t, k.Size, chunkMin(avg))
+		}
+		h := BLAKE3.new()
+		h.Write(data[n : n+k.Size])
+		assert.Equal(t, h.Sum(nil), k.Digest[:])
+		n += k.Size
+	}
+	assert.Equal(t, int64(len(data)), n)
+	assert.InDelta(t, len(data)/avg, len(want), float64(len(data)/avg)/4)
+
+	// Boundaries resynchronize after an insertion
+	mod := append(append(append([]byte(nil), data[:5000]...), "insert"...), data[5000:]...)
+	c := newChunker(BLAKE3, avg)
+	_, _ = c.Write(mod)
+	have := c.chunks()
+	assert.Equal(t, want[len(want)-100:], have[len(have)-100:])
+	assert.NoError(t, validChunkSize(0))
+	assert.Error(t, validChunkSize(3*MinChunkSize))
+	assert.Error(t, validChunkSize(MinChunkSize/2))
+}
+
+func TestScanChunks(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	a := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(a)
+	b := bytes.Clone(a)
+	copy(b[100000:], "modified")
+	fsys := fstest.MapFS{
+		"a":     {Data: a, ModTime: t0},
+		"b":     {Data: b, ModTime: t0},
+		"c/a":   {Data: a, ModTime: t0},
+		"small": {Data: []byte("small"), ModTime: t0},
+	}
+	s := &Scanner{ChunkSize: MinChunkSize}
+	x, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	assert.Equal(t, MinChunkSize, x.ChunkSize())
+	for _, f := range x.Files() {
+		var n int64
+		for _, k := range x.Chunks(f) {
+			n += k.Size
+		}
+		assert.Equal(t, f.size, n, "%s", f.path)
+	}
+	small := x.ToTree().File("small")
+	assert.Equal(t, []Chunk{{small.digest, small.size}}, x.Chunks(small))
+
+	// Near-duplicates share most chunks
+	sim := x.ToTree().Similar(0.5)
+	require.Len(t, sim, 1)
+	assert.Equal(t, x.ToTree().File("a").digest, sim[0].A.digest)
+	assert.Equal(t, path("b"), sim[0].B.path)
+	assert.Greater(t, sim[0].Ratio, 0.9)
+	assert.Less(t, sim[0].Ratio, 1.0)
+	st := x.ToTree().ChunkStats()
+	assert.Equal(t, 4, st.Files)
+	assert.Equal(t, int64(3*len(a)+5), st.Size)
+	assert.Equal(t, int64(2*len(a)+5), st.FileDedup)
+	assert.Less(t, st.ChunkDedup, int64(len(a)+len(a)/10))
+	assert.Zero(t, st.Unchunked)
+
+	// Sparse files are counted by their allocated sizes
+	tr := x.ToTree()
+	tr.alloc = map[path]int64{"b": 4096}
+	sparse := tr.ChunkStats()
+	assert.Equal(t, st.Size-int64(len(b))+4096, sparse.Size)
+	assert.Equal(t, st.FileDedup-int64(len(b))+4096, sparse.FileDedup)
+
+	// Chunks are saved next to the index
+	name := filepath.Join(t.TempDir(), "index")
+	require.NoError(t, x.Save(name))
+	y, err := Load(name)
+	require.NoError(t, err)
+	assert.Equal(t, x.chunks, y.chunks)
+	require.NoError(t, y.Save(name))
+	assert.FileExists(t, chunksName(name)+".bak")
+
+	// Unchanged files are only hashed again if the chunk size changes
+	hashed := func(s *Scanner) int {
+		x, err := Load(name)
+		require.NoError(t, err)
+		var n uint64
+		s.ProgFn = func(p *Progress) {
+			if p.IsFinal() {
+				n, _ = p.Hashed()
+			}
+		}
+		x, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+		require.NoError(t, err)
+		assert.Equal(t, s.ChunkSize, x.ChunkSize())
+		return int(n)
+	}
+	assert.Equal(t, 0, hashed(&Scanner{ChunkSize: MinChunkSize}))
+	assert.Equal(t, 3, hashed(&Scanner{ChunkSize: 2 * MinChunkSize}))
+	assert.Equal(t, 0, hashed(&Scanner{}))
+	require.NoError(t, Remove(name))
+	assert.NoFileExists(t, chunksName(name))
+}
+
+func TestSimilarCommonChunks(t *testing.T) {
+	// All files share a chunk with too many references and only the first two
+	// share another chunk, which determines their similarity.
+	k := chunkMin(MinChunkSize)
+	x := &Index{root: "/", chunkSize: MinChunkSize, chunks: make(map[Digest][]Chunk)}
+	for i := 0; i <= maxChunkRefs; i++ {
+		c := []Chunk{{Digest{1}, k}, {Digest{3, byte(i)}, k}}
+		if i < 2 {
+			c = append(c, Chunk{Digest{2}, k})
+		}
+		f := &File{path(fmt.Sprint("f", i)), Digest{0xff, byte(i)}, int64(len(c)) * k, time.Time{}, flagNone, nil}
+		x.groups = append(x.groups, Files{f})
+		x.chunks[f.digest] = c
+	}
+	sim := x.ToTree().Similar(0.3)
+	require.Len(t, sim, 1)
+	assert.Equal(t, path("f0"), sim[0].A.path)
+	assert.Equal(t, path("f1"), sim[0].B.path)
+	assert.Equal(t, k, sim[0].Shared)
+	assert.InDelta(t, 1.0/3, sim[0].Ratio, 1e-9)
+}
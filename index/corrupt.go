@@ -0,0 +1,282 @@
+package index
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Corrupt is a file that is likely a damaged copy left by a failed copy
+// operation. It may be removed once the intact version is confirmed.
+type Corrupt struct {
+	*File
+	Zero bool  // File contents are all zeros
+	Full *File // Intact file with the same name, if any
+}
+
+// FindCorrupt finds likely-corrupt copies among the existing files in t. A
+// non-empty file is corrupt if its contents are entirely zero, or if its digest
+// matches the same-length prefix of a larger file with the same name in
+// another directory, which indicates that it was truncated. For a file with
+// zeros, Full is set to a file with the same name and size, but different
+// contents. For a truncated file, Full is the largest matching file.
+//
+// Zero digests are computed without reading any files, but hashing zeros takes
+// as long as hashing a file of the same size. Only files without any allocated
+// space, such as sparse files recorded by Scan, are checked for zeros unless
+// allZeros is true, in which case zeros are hashed up to the size of the
+// largest file. Prefix digests are computed by reading larger files only up to
+// the size of the largest smaller file with the same name, taking a digest at
+// each file size. Files with partial digests cannot be compared. The index
+// should be up to date because the digests of smaller files are not checked.
+// A non-nil error is returned if ctx is canceled.
+func (s *Scanner) FindCorrupt(ctx context.Context, t *Tree, fsys fs.FS, allZeros bool) ([]*Corrupt, error) {
+	cp := ctxPoller(ctx.Done())
+	byName := make(map[string]Files)
+	var sizes []int64
+	for _, g := range t.idx {
+		if g[0].size == 0 {
+			continue
+		}
+		n := len(sizes)
+		for _, f := range g {
+			if !f.flag.IsGone() {
+				byName[f.base()] = append(byName[f.base()], f)
+				if n == len(sizes) && !f.flag.IsPartial() && (allZeros || t.unallocated(f)) {
+					sizes = append(sizes, f.size)
+				}
+			}
+		}
+	}
+	slices.Sort(sizes)
+	sizes = slices.Compact(sizes)
+
+	// Compute the digests of all-zero files of each size in the background.
+	// BLAKE3 digests are computed in parallel.
+	var wg sync.WaitGroup
+	var zeros []Digest
+	if len(sizes) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if t.hash == BLAKE3 {
+				zeros = zeroDigests(cp, sizes)
+				return
+			}
+			h := t.hash.NewHasher(func(int) error {
+				if cp.canceled() {
+					return context.Canceled
+				}
+				return nil
+			})
+			zeros, _ = h.prefixes(&sparseFile{size: sizes[len(sizes)-1]}, sizes)
+		}()
+	}
+
+	// Find the sizes of smaller files that may be truncated copies of larger
+	// ones. Each larger file is read once for all smaller sizes of its name,
+	// and files with the same content are only read once.
+	offs := make(map[*File][]int64)
+	keyOf := func(f *File) *File {
+		if f.flag.IsPartial() {
+			return f
+		}
+		return existing(t.idx[f.digest])
+	}
+	for _, all := range byName {
+		if len(all) < 2 {
+			continue
+		}
+		slices.SortFunc(all, func(a, b *File) int {
+			if c := cmp.Compare(a.size, b.size); c != 0 {
+				return c
+			}
+			return a.path.cmp(b.path)
+		})
+		var small []int64 // Distinct sizes of files with full digests
+		for _, f := range all {
+			n := len(small)
+			if n > 0 && small[n-1] == f.size {
+				n-- // Same size
+			}
+			if n > 0 {
+				key := keyOf(f)
+				offs[key] = append(offs[key], small[:n]...)
+			}
+			if !f.flag.IsPartial() && n == len(small) {
+				small = append(small, f.size)
+			}
+		}
+	}
+
+	// Compute prefix digests of the larger files
+	keys := make(Files, 0, len(offs))
+	for f, o := range offs {
+		slices.Sort(o)
+		offs[f] = slices.Compact(o)
+		keys = append(keys, f)
+	}
+	keys.Sort()
+	var prog *Progress
+	var tick func()
+	var read atomic.Uint64
+	if s.ProgFn != nil {
+		prog = newProgress(time.Now())
+		for _, f := range keys {
+			prog.totalFiles++
+			prog.totalBytes += uint64(offs[f][len(offs[f])-1])
+		}
+		tick = func() {
+			prog.sampleFiles += read.Swap(0)
+			prog.update(time.Now())
+			s.ProgFn(prog)
+		}
+	}
+	prefixes := make([][]Digest, len(keys))
+	cfg := *s
+	cfg.Hash, cfg.Secondary, cfg.ChunkSize = t.hash, nil, 0
+	cfg.parallel(cp, len(keys), cfg.monitor(cp, prog), tick, func(err error) {
+		if s.ErrFn != nil {
+			s.ErrFn(err)
+		}
+	}, func(h *Hasher, i int) (err error) {
+		prefixes[i], err = h.readPrefixes(fsys, keys[i], t.mtime, offs[keys[i]])
+		read.Add(1)
+		return
+	})
+	if prog != nil {
+		prog.sampleFiles += read.Swap(0)
+	}
+	s.finalProgress(prog)
+	wg.Wait()
+	if cp.canceled() {
+		return nil, ctx.Err()
+	}
+
+	// Report zero files and truncated copies
+	isZero := func(f *File) bool {
+		i, ok := slices.BinarySearch(sizes, f.size)
+		return ok && zeros != nil && !f.flag.IsPartial() && f.digest == zeros[i]
+	}
+	found := make(map[*File]*Corrupt)
+	for _, all := range byName {
+		for _, f := range all {
+			if !isZero(f) {
+				continue
+			}
+			c := &Corrupt{File: f, Zero: true}
+			for _, other := range all {
+				if other.size == f.size && other.digest != f.digest && !isZero(other) {
+					c.Full = other
+					break
+				}
+			}
+			found[f] = c
+		}
+	}
+	type prefix struct {
+		name string
+		size int64
+		d    Digest
+	}
+	largest := make(map[prefix]*File)
+	keyIdx := make(map[*File]int, len(keys))
+	for i, f := range keys {
+		keyIdx[f] = i
+	}
+	for name, all := range byName {
+		for _, f := range all {
+			key := keyOf(f)
+			o, ok := offs[key]
+			if !ok || prefixes[keyIdx[key]] == nil {
+				continue // Nothing smaller or read error
+			}
+			for i, d := range prefixes[keyIdx[key]] {
+				if o[i] >= f.size {
+					break
+				}
+				k := prefix{name, o[i], d}
+				if g := largest[k]; g == nil || g.size < f.size {
+					largest[k] = f // Prefer the largest copy
+				}
+			}
+		}
+	}
+	for name, all := range byName {
+		for _, f := range all {
+			full := largest[prefix{name, f.size, f.digest}]
+			if full == nil || f.flag.IsPartial() {
+				continue
+			}
+			if c := found[f]; c == nil {
+				found[f] = &Corrupt{File: f, Full: full}
+			} else if c.Full == nil {
+				c.Full = full
+			}
+		}
+	}
+	all := make([]*Corrupt, 0, len(found))
+	for _, c := range found {
+		all = append(all, c)
+	}
+	slices.SortFunc(all, func(a, b *Corrupt) int { return a.path.cmp(b.path) })
+	return all, nil
+}
+
+// unallocated returns whether file f is known to have no allocated space.
+func (t *Tree) unallocated(f *File) bool {
+	a, ok := t.alloc[f.path]
+	return ok && a == 0
+}
+
+// readPrefixes computes the digests of the first offs[i] bytes of file f,
+// which must not have been modified since it was indexed. Offsets must be in
+// ascending order.
+func (h *Hasher) readPrefixes(fsys fs.FS, f *File, tol TimeTolerance, offs []int64) ([]Digest, error) {
+	name := string(f.path)
+	r, err := fsys.Open(name)
+	if err != nil {
+		return nil, fileError(OpenErr, name, err)
+	}
+	defer func() { _ = r.Close() }()
+	fi, err := r.Stat()
+	if err != nil {
+		return nil, fileError(StatErr, name, err)
+	}
+	if !f.isSame(tol, fi, nil) {
+		return nil, fileError(ModifiedErr, name, nil)
+	}
+	if h.noCache {
+		defer fadvise(r, adviseDontNeed)
+	}
+	d, err := h.prefixes(r, offs)
+	if err != nil {
+		return nil, fileError(ReadErr, name, err)
+	}
+	return d, nil
+}
+
+// prefixes computes the digests of the first offs[i] bytes read from r.
+// Offsets must be in ascending order.
+func (h *Hasher) prefixes(r io.Reader, offs []int64) ([]Digest, error) {
+	h.h.Reset()
+	w := h.writer()
+	all := make([]Digest, len(offs))
+	var pos int64
+	for i, off := range offs {
+		n, err := io.CopyBuffer(w, io.LimitReader(r, off-pos), h.b[:])
+		if pos += n; err == nil && pos != off {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		all[i] = h.digest()
+	}
+	return all, nil
+}
@@ -0,0 +1,82 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindCorrupt(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	fsys := fstest.MapFS{
+		"0/big":     {Data: append([]byte("Z"), data[1:]...), ModTime: t0},
+		"a/big":     {Data: data, ModTime: t0},
+		"b/big":     {Data: data[:10], ModTime: t0},
+		"c/big":     {Data: data[:20], ModTime: t0},
+		"d/big":     {Data: []byte("0123x"), ModTime: t0},
+		"e/big":     {Data: make([]byte, len(data)), ModTime: t0},
+		"f/zero":    {Data: make([]byte, 3), ModTime: t0},
+		"f/empty":   {ModTime: t0},
+		"g/other":   {Data: data[:10], ModTime: t0},
+		"g/other.1": {Data: data, ModTime: t0},
+	}
+	for _, alg := range []Algorithm{BLAKE3, SHA256} {
+		s := &Scanner{Hash: alg}
+		x, err := s.Scan(context.Background(), fsys)
+		require.NoError(t, err)
+		all, err := s.FindCorrupt(context.Background(), x.ToTree(), fsys, true)
+		require.NoError(t, err)
+		type result struct {
+			path, full string
+			zero       bool
+		}
+		var have []result
+		for _, c := range all {
+			r := result{path: string(c.path), zero: c.Zero}
+			if c.Full != nil {
+				r.full = string(c.Full.path)
+			}
+			have = append(have, r)
+		}
+		want := []result{
+			{"b/big", "a/big", false},
+			{"c/big", "a/big", false},
+			{"e/big", "0/big", true},
+			{"f/zero", "", true},
+		}
+		assert.Equal(t, want, have, "%v", alg)
+
+		// Only files without allocated space are checked for zeros by default
+		tr := x.ToTree()
+		tr.alloc = map[path]int64{"f/zero": 0, "a/big": 4096}
+		all, err = s.FindCorrupt(context.Background(), tr, fsys, false)
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+		assert.Equal(t, path("b/big"), all[0].path)
+		assert.Equal(t, path("c/big"), all[1].path)
+		assert.Equal(t, path("f/zero"), all[2].path)
+		assert.True(t, all[2].Zero)
+	}
+
+	// Modified files are not read
+	s := &Scanner{}
+	x, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	fsys["a/big"].ModTime = t0.Add(time.Second)
+	var errs []error
+	s.ErrFn = func(err error) { errs = append(errs, err) }
+	all, err := s.FindCorrupt(context.Background(), x.ToTree(), fsys, true)
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "a/big")
+	require.Len(t, all, 3)
+	assert.Equal(t, path("b/big"), all[0].path)
+	assert.Equal(t, path("c/big"), all[0].Full.path)
+	assert.Equal(t, path("e/big"), all[1].path)
+	assert.Equal(t, path("f/zero"), all[2].path)
+}
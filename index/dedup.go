@@ -80,11 +80,13 @@ type dedup struct {
 // fast operation that simply ensures that every unique file under p, except
 // those that can be ignored, has at least one copy outside p that is not marked
 // for possible removal. maxLost is the maximum number of unique files that can
-// be lost for the directory to still be considered a duplicate.
+// be lost for the directory to still be considered a duplicate. Directories
+// containing paths that could not be indexed are never duplicates because their
+// full contents are unknown.
 func (dd *dedup) isDup(tree *Tree, p path, maxLost int) bool {
 	dd.tree, dd.root = nil, nil
 	root := tree.dirs[p]
-	if root == nil || root.atom != nil && root.atom != root {
+	if root == nil || root.unknown || root.atom != nil && root.atom != root {
 		return false
 	}
 	if dd.safe == nil {
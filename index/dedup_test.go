@@ -2,6 +2,7 @@ package index
 
 import (
 	"context"
+	"io/fs"
 	"testing"
 	"testing/fstest"
 
@@ -36,3 +37,40 @@ func TestDedup(t *testing.T) {
 	require.False(t, dd.isDup(tr, "X/Y/", 0))
 	require.True(t, dd.isDup(tr, "X/Z/", 1))
 }
+
+func TestDedupUnknown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"A/B/a0":   {Data: []byte("a")},
+		"A/B/C/b0": {Data: []byte("b")},
+		"X/a1":     {Data: []byte("a")},
+		"X/b1":     {Data: []byte("b")},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	x.errs = []*FileError{{ReadErr, "A/B/c", nil}}
+	tr := x.ToTree()
+
+	var dd dedup
+	require.False(t, dd.isDup(tr, "A/", 0))
+	require.False(t, dd.isDup(tr, "A/B/", 0))
+	require.True(t, dd.isDup(tr, "A/B/C/", 0))
+	dups := tr.Dups(".", 0, 0)
+	require.Len(t, dups, 2)
+	require.Equal(t, path("A/B/C/"), dups[0].path)
+	require.Equal(t, path("X/"), dups[1].path)
+}
+
+func TestDedupSymlink(t *testing.T) {
+	fsys := fstest.MapFS{
+		"A/a0":   {Data: []byte("a")},
+		"A/link": {Data: []byte("a0"), Mode: fs.ModeSymlink},
+		"X/a1":   {Data: []byte("a")},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, x.Errors())
+
+	// Symlinks do not make the directory unknown
+	var dd dedup
+	require.True(t, dd.isDup(x.ToTree(), "A/", 0))
+}
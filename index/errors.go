@@ -0,0 +1,102 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	stdpath "path"
+)
+
+// ErrorKind classifies file-specific errors.
+type ErrorKind string
+
+const (
+	OpenErr     ErrorKind = "open"                   // File could not be opened
+	StatErr     ErrorKind = "stat"                   // File info could not be read
+	ReadErr     ErrorKind = "read"                   // File contents could not be read
+	CloseErr    ErrorKind = "close"                  // File could not be closed
+	SizeErr     ErrorKind = "size-mismatch"          // Bytes read differ from file size
+	ModifiedErr ErrorKind = "modified-while-reading" // File changed while hashing
+	PathErr     ErrorKind = "unsupported-path"       // Path cannot be stored in the index
+	TypeErr     ErrorKind = "not-regular"            // Not a regular file or directory
+	WalkErr     ErrorKind = "walk"                   // Directory could not be read
+	XattrErr    ErrorKind = "xattr"                  // Extended attribute could not be accessed
+)
+
+// FileError is an error related to a specific file or directory.
+type FileError struct {
+	Kind ErrorKind
+	Path string
+	Err  error // Underlying error, if any
+}
+
+// Notice is an informational error reported to ErrFn. It does not affect the
+// index contents, such as when an unsupported hashing order falls back to walk
+// order.
+type Notice struct{ Err error }
+
+func (n *Notice) Error() string { return n.Err.Error() }
+func (n *Notice) Unwrap() error { return n.Err }
+
+// fileError returns a new FileError.
+func fileError(kind ErrorKind, name string, err error) *FileError {
+	return &FileError{kind, name, err}
+}
+
+func (e *FileError) Error() string {
+	var what string
+	switch e.Kind {
+	case OpenErr:
+		what = "failed to open file"
+	case StatErr:
+		what = "failed to stat file"
+	case ReadErr:
+		what = "failed to read file"
+	case CloseErr:
+		what = "failed to close file"
+	case SizeErr:
+		what = "file size mismatch"
+	case ModifiedErr:
+		what = "file modified while reading"
+	case PathErr:
+		return fmt.Sprintf("index: unsupported file path: %q", e.Path)
+	case TypeErr:
+		what = "not a regular file or directory"
+	case WalkErr:
+		what = "walk error"
+	case XattrErr:
+		what = "extended attribute error"
+	default:
+		what = string(e.Kind)
+	}
+	if e.Err == nil {
+		return fmt.Sprintf("index: %s: %s", what, e.Path)
+	}
+	return fmt.Sprintf("index: %s: %s (%v)", what, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// entry returns the error entry to be recorded in the index or nil if the error
+// does not need to be recorded. Directory errors are recorded with a trailing
+// '/'. Unsupported paths are recorded as errors of their parent directory.
+// Entries that are not regular files, such as symlinks, are not recorded
+// because they do not make the contents of their directory unknown.
+func (e *FileError) entry() *FileError {
+	if errors.Is(e.Err, fs.ErrNotExist) || e.Kind == TypeErr {
+		return nil // File was removed or is not a regular file
+	}
+	var p string
+	switch e.Kind {
+	case WalkErr:
+		p = cleanPath(e.Path + "/")
+	case PathErr:
+		p = cleanPath(stdpath.Dir(e.Path) + "/")
+	default:
+		p = cleanPath(e.Path)
+	}
+	if p == "" {
+		return nil
+	}
+	return fileError(e.Kind, p, nil)
+}
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileError(t *testing.T) {
+	err := error(fileError(OpenErr, "a/b", fs.ErrNotExist))
+	require.Equal(t, "index: failed to open file: a/b (file does not exist)", err.Error())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Equal(t, `index: unsupported file path: "\ta"`, fileError(PathErr, "\ta", nil).Error())
+	require.Equal(t, "index: file modified while reading: c", fileError(ModifiedErr, "c", nil).Error())
+
+	_, err = NewHasher(nil).Read(fstest.MapFS{}, "x", false)
+	var fe *FileError
+	require.True(t, errors.As(err, &fe))
+	require.Equal(t, &FileError{OpenErr, "x", fe.Err}, fe)
+}
+
+func TestFileErrorEntry(t *testing.T) {
+	require.Nil(t, fileError(OpenErr, "a", fs.ErrNotExist).entry())
+	require.Nil(t, fileError(TypeErr, "a", nil).entry())
+	require.Equal(t, fileError(OpenErr, "a/b", nil), fileError(OpenErr, "a/b", fs.ErrPermission).entry())
+	require.Equal(t, fileError(WalkErr, "a/", nil), fileError(WalkErr, "a", fs.ErrPermission).entry())
+	require.Equal(t, fileError(WalkErr, ".", nil), fileError(WalkErr, ".", fs.ErrPermission).entry())
+	require.Equal(t, fileError(PathErr, "a/", nil), fileError(PathErr, "a/\tb", nil).entry())
+	require.Equal(t, fileError(PathErr, ".", nil), fileError(PathErr, "b\n", nil).entry())
+}
@@ -10,6 +10,7 @@ const (
 	flagKeep                  // File must be preserved (value and mask)
 	flagGone    Flag = 1 << 2 // File no longer exists
 	flagSame    Flag = 1 << 4 // File exists and hasn't changed (runtime only)
+	flagPartial Flag = 1 << 5 // Digest does not cover full file contents
 	flagPersist Flag = 0x0F   // Persistent flags
 )
 
@@ -32,6 +33,11 @@ func (a Flag) Keep() bool { return a&flagKeep == flagKeep }
 // IsGone returns whether the file no longer exists.
 func (a Flag) IsGone() bool { return a&flagGone != 0 }
 
+// IsPartial returns whether the file digest was computed without reading the
+// full file contents. Such digests identify unique files, but cannot be used to
+// verify them.
+func (a Flag) IsPartial() bool { return a&flagPartial != 0 }
+
 // MayRemove returns whether the file may be removed.
 func (a Flag) MayRemove() bool { return a&flagKeep == flagDup || a&flagKeep == flagJunk }
 
@@ -15,6 +15,7 @@ type File struct {
 	size    int64
 	modTime time.Time
 	flag    Flag
+	sums    Sums // Secondary digests shared by all files in the group
 }
 
 // Digest returns file digest.
@@ -29,11 +30,14 @@ func (f *File) ModTime() time.Time { return f.modTime }
 // Flag returns file flags.
 func (f *File) Flag() Flag { return f.flag }
 
+// Sums returns the secondary digests of the file or nil if there are none.
+func (f *File) Sums() Sums { return f.sums }
+
 // isSame returns whether the file still has the same name, size, and
-// modification time.
-func (f *File) isSame(fi fs.FileInfo, err error) bool {
+// modification time within the specified tolerance.
+func (f *File) isSame(tol TimeTolerance, fi fs.FileInfo, err error) bool {
 	return err == nil && fi.Mode().IsRegular() && fi.Size() == f.size &&
-		fi.ModTime().Equal(f.modTime)
+		tol.Equal(fi.ModTime(), f.modTime)
 }
 
 // canIgnore returns whether the specified file name can be ignored for the
@@ -91,6 +95,7 @@ type dir struct {
 	dirs        dirs  // Subdirectories
 	files       Files // Files in this directory
 	atom        *dir  // Atomic container directory, such as .git
+	unknown     bool  // Directory contains paths that could not be indexed
 	totalDirs   int   // Total number of direct and indirect directories
 	totalFiles  int   // Total number of direct and indirect files
 	uniqueFiles int   // Total number of direct and indirect unique files
@@ -2,39 +2,38 @@ package index
 
 import (
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"unsafe"
-
-	"github.com/zeebo/blake3"
 )
 
 // Digest is the output of the hash function.
 type Digest [32]byte
 
-// newHash creates new hash state.
-var newHash = blake3.New
-
-func init() {
-	if len(Digest{}) != newHash().Size() {
-		panic("index: hash size mismatch")
-	}
-}
-
 // Hasher is a file hasher.
 type Hasher struct {
-	h blake3.Hasher
-	m func(int) error
-	b [1024 * 1024]byte
+	h          hash.Hash
+	alg        Algorithm
+	m          func(int) error
+	noCache    bool          // Evict file data from the page cache
+	xattr      bool          // Use digests cached in extended attributes
+	par        chan struct{} // Semaphore for hashing large files in parallel
+	sums       *sumWriter    // Secondary digests to compute
+	last       Sums          // Secondary digests of the last file
+	chunks     *chunker      // Content-defined chunking
+	lastChunks []Chunk       // Chunks of the last file
+	alloc      int64         // Allocated size of the last file or -1 if unknown
+	b          [1024 * 1024]byte
 }
 
-// NewHasher returns a new file hasher. If monitor is non-nil, it is called
-// after every write with the number of bytes written. Hashing is aborted if
-// monitor returns an error.
+// NewHasher returns a new BLAKE3 file hasher. If monitor is non-nil, it is
+// called after every write with the number of bytes written. Hashing is aborted
+// if monitor returns an error.
 func NewHasher(monitor func(n int) error) *Hasher {
-	return &Hasher{h: *newHash(), m: monitor}
+	return BLAKE3.NewHasher(monitor)
 }
 
 // Read computes the digest of the specified file. If the file is empty and
@@ -46,7 +45,7 @@ func (h *Hasher) Read(fsys fs.FS, name string, nameFallback bool) (*File, error)
 	}
 	f, err := fsys.Open(name)
 	if err != nil {
-		return nil, fmt.Errorf("index: failed to open file: %s (%w)", name, err)
+		return nil, fileError(OpenErr, name, err)
 	}
 	defer func() {
 		if f != nil {
@@ -55,41 +54,120 @@ func (h *Hasher) Read(fsys fs.FS, name string, nameFallback bool) (*File, error)
 	}()
 	fi, err := f.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("index: failed to stat file: %s (%w)", name, err)
+		return nil, fileError(StatErr, name, err)
+	}
+	data := dataExtents(f, fi)
+	if a, ok := allocated(fi); ok && data != nil {
+		h.alloc = a
+	} else {
+		h.alloc = -1
+	}
+	h.last, h.lastChunks = nil, nil
+	if h.xattr && h.alg == BLAKE3 && !h.needsData() && (fi.Size() > 0 || !nameFallback) {
+		if d, ok := getCache(f, fi); ok {
+			return &File{strictFilePath(name), d, fi.Size(), fi.ModTime(), flagNone, nil}, nil
+		}
 	}
 
-	// Compute digest
-	h.h.Reset()
-	n, err := io.CopyBuffer(h.writer(), f, h.b[:])
-	err2 := f.Close()
-	if f = nil; err != nil {
-		return nil, fmt.Errorf("index: failed to read file: %s (%w)", name, err)
+	// Compute digest. Holes in sparse files are hashed without reading them.
+	if h.noCache {
+		fadvise(f, adviseSequential)
+	}
+	var src io.Reader = f
+	if data != nil {
+		src = &sparseFile{r: f.(io.ReaderAt), data: data, size: fi.Size()}
+	}
+	var n int64
+	var d Digest
+	if r, ok := src.(io.ReaderAt); ok && h.par != nil && h.alg == BLAKE3 && !h.needsData() && fi.Size() >= parallelMin {
+		d, n, err = h.readParallel(r, fi.Size())
+	} else {
+		n, err = h.copy(src)
+		d = h.digest()
 	}
-	if err2 != nil {
-		return nil, fmt.Errorf("index: failed to close file: %s (%w)", name, err2)
+	if h.noCache {
+		fadvise(f, adviseDontNeed)
+	}
+	if err != nil {
+		return nil, fileError(ReadErr, name, err)
 	}
 	if n != fi.Size() {
-		return nil, fmt.Errorf("index: file size mistmach: %s (want %d, got %d)", name, fi.Size(), n)
+		return nil, fileError(SizeErr, name, fmt.Errorf("want %d, got %d", fi.Size(), n))
 	}
-	if n == 0 && nameFallback {
+	named := n == 0 && nameFallback
+	if named {
 		// Zero-length files get a unique hash based on their full name
 		_, _ = h.writer().Write(unsafe.Slice(unsafe.StringData(name), len(name)))
+		d = h.digest()
 	}
 
-	// Verify that file size and modtime have not changed
+	// Verify that file size and modtime have not changed before caching the
+	// digest. Name-based digests are never cached.
 	fi2, err := fs.Stat(fsys, name)
 	if err != nil || fi.Size() != fi2.Size() || fi.ModTime() != fi2.ModTime() {
-		return nil, fmt.Errorf("index: file modified while reading: %s", name)
+		return nil, fileError(ModifiedErr, name, nil)
+	}
+	if h.xattr && h.alg == BLAKE3 && !named {
+		setCache(f, fi, d)
+	}
+	err = f.Close()
+	if f = nil; err != nil {
+		return nil, fileError(CloseErr, name, err)
 	}
 
-	file := &File{strictFilePath(name), h.digest(), fi.Size(), fi.ModTime(), flagNone}
+	h.finish()
+	file := &File{strictFilePath(name), d, fi.Size(), fi.ModTime(), flagNone, nil}
 	return file, nil
 }
 
+// ReadStream computes the digest of all data read from r until EOF. It returns
+// the number of bytes read.
+func (h *Hasher) ReadStream(r io.Reader) (Digest, int64, error) {
+	h.last, h.lastChunks = nil, nil
+	n, err := h.copy(r)
+	if err == nil {
+		h.finish()
+	}
+	return h.digest(), n, err
+}
+
+// copy resets the hash state and writes all data from r to the hash.
+func (h *Hasher) copy(r io.Reader) (int64, error) {
+	h.h.Reset()
+	w := h.writer()
+	if h.needsData() {
+		all := []io.Writer{w}
+		if h.sums != nil {
+			h.sums.reset()
+			all = append(all, h.sums.w)
+		}
+		if h.chunks != nil {
+			h.chunks.reset()
+			all = append(all, h.chunks)
+		}
+		w = io.MultiWriter(all...)
+	}
+	return io.CopyBuffer(w, r, h.b[:])
+}
+
+// needsData returns whether the Hasher computes secondary digests or chunks,
+// which require reading file contents sequentially.
+func (h *Hasher) needsData() bool { return h.sums != nil || h.chunks != nil }
+
+// finish saves the secondary digests and chunks of the last file.
+func (h *Hasher) finish() {
+	if h.sums != nil {
+		h.last = h.sums.sums()
+	}
+	if h.chunks != nil {
+		h.lastChunks = h.chunks.chunks()
+	}
+}
+
 // writer returns the hash io.Writer interface.
 func (h *Hasher) writer() io.Writer {
 	if h.m == nil {
-		return &h.h
+		return h.h
 	}
 	return (*monWriter)(h)
 }
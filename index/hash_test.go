@@ -2,8 +2,12 @@ package index
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"io/fs"
+	"strings"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -33,10 +37,10 @@ func TestHasher(t *testing.T) {
 		"~":         {Data: v31744, ModTime: t2},
 	}
 	want := Files{
-		&File{"a/b", d1, 1, t1, flagNone},
-		&File{path(testVec[:2]), d2, 0, t1, flagNone},
-		&File{"012", d3, 3, t2, flagNone},
-		&File{"~", d31744, 31744, t2, flagNone},
+		&File{"a/b", d1, 1, t1, flagNone, nil},
+		&File{path(testVec[:2]), d2, 0, t1, flagNone, nil},
+		&File{"012", d3, 3, t2, flagNone, nil},
+		&File{"~", d31744, 31744, t2, flagNone, nil},
 	}
 
 	h := NewHasher(nil)
@@ -88,6 +92,50 @@ func TestHasherMonitor(t *testing.T) {
 	require.Equal(t, []int{1}, calls)
 }
 
+func TestAlgorithm(t *testing.T) {
+	var a Algorithm
+	for _, s := range []string{"blake3", "SHA256", "sha512/256"} {
+		require.NoError(t, a.Set(s))
+		require.Equal(t, strings.ToLower(s), a.String())
+	}
+	require.Error(t, a.Set("sha3"))
+	require.NoError(t, a.Set("md5"))
+	require.False(t, a.IsPrimary())
+
+	fsys := fstest.MapFS{"a": {Data: []byte("abc")}}
+	for a, want := range map[Algorithm]Digest{
+		BLAKE3:     blake3.Sum256(fsys["a"].Data),
+		SHA256:     sha256.Sum256(fsys["a"].Data),
+		SHA512_256: sha512.Sum512_256(fsys["a"].Data),
+	} {
+		f, err := a.NewHasher(nil).Read(fsys, "a", false)
+		require.NoError(t, err)
+		require.Equal(t, want, f.digest, "%v", a)
+	}
+
+	// Rescan requires a matching algorithm
+	x, err := (&Scanner{Hash: SHA256}).Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	require.Equal(t, SHA256, x.Hash())
+	require.Equal(t, Digest(sha256.Sum256(fsys["a"].Data)), x.Files()[0].digest)
+	_, err = (&Scanner{}).Rescan(context.Background(), x.ToTree(), fsys)
+	require.ErrorContains(t, err, "hash algorithm mismatch")
+	y, err := (&Scanner{Hash: SHA256}).Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	require.Equal(t, SHA256, y.Hash())
+}
+
+func TestHasherReadStream(t *testing.T) {
+	h := SHA256.NewHasher(nil)
+	h.setSums([]Algorithm{MD5})
+	d, n, err := h.ReadStream(strings.NewReader("abc"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, Digest(sha256.Sum256([]byte("abc"))), d)
+	md := md5.Sum([]byte("abc"))
+	require.Equal(t, Sums{MD5: md[:]}, h.Sums())
+}
+
 func testDigest(t *testing.T, s string) (d Digest) {
 	n, err := hex.Decode(d[:], []byte(s))
 	require.NoError(t, err)
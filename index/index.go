@@ -24,7 +24,16 @@ import (
 // Index is the root of an indexed file system.
 type Index struct {
 	root   string
+	hash   Algorithm
+	mtime  TimeTolerance
+	errs   []*FileError    // Paths that could not be indexed
+	alloc  map[path]int64  // Allocated sizes of sparse files
+	sums   map[Digest]Sums // Secondary digests
+	chunks map[Digest][]Chunk
 	groups []Files
+
+	secondary []Algorithm // Secondary digest algorithms
+	chunkSize int         // Average chunk size or 0 if chunking is disabled
 }
 
 // New creates a new file index.
@@ -32,10 +41,12 @@ func New(root string, all Files) *Index {
 	if len(all) == 0 {
 		return &Index{root: root}
 	}
-	return &Index{root, groupByDigest(all)}
+	return &Index{root: root, groups: groupByDigest(all)}
 }
 
-// Load loads index contents from the specified file path.
+// Load loads index contents from the specified file path. If the index uses
+// content-defined chunking, chunks are loaded from a separate file with a
+// ".chunks" extension.
 func Load(name string) (*Index, error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -51,11 +62,18 @@ func Load(name string) (*Index, error) {
 	if f = nil; err == nil {
 		err = err2
 	}
+	if err == nil && x.chunkSize != 0 {
+		var all map[Digest][]Chunk
+		if all, err = loadChunks(chunksName(name), x.chunkSize); err == nil {
+			x.setChunks(all)
+		}
+	}
 	return x, err
 }
 
 // Save saves index contents to the specified file path. If the file already
-// exists, it is first renamed with a ".bak" extension.
+// exists, it is first renamed with a ".bak" extension. The same applies to the
+// chunks file if the index uses content-defined chunking.
 func (x *Index) Save(name string) error { return x.save(name, true) }
 
 // Overwrite saves index contents to the specified file path. If the file
@@ -66,32 +84,61 @@ func (x *Index) Overwrite(name string) error { return x.save(name, false) }
 // the file already exists, it is first renamed by adding a ".bak" extension.
 func (x *Index) save(name string, backup bool) (err error) {
 	name = filepath.Clean(name)
-	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	tmp, err := writeTemp(name, x.Write)
 	if err != nil {
 		return err
 	}
+	var chunks string
+	if x.chunkSize != 0 {
+		if chunks, err = writeTemp(chunksName(name), x.writeChunks); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
 	defer func() {
 		if err != nil {
-			_ = f.Close()
-			_ = os.Remove(f.Name())
+			_ = os.Remove(tmp)
+			if chunks != "" {
+				_ = os.Remove(chunks)
+			}
 		}
 	}()
-	if err = x.Write(f); err != nil {
-		return err
-	}
-	if err = f.Close(); err != nil {
-		return err
-	}
 	if backup {
 		if fi, err := os.Lstat(name); err == nil && !fi.Mode().IsRegular() {
 			return fmt.Errorf("index: cannot backup irregular file: %s", name)
 		}
-		err = os.Rename(name, name+".bak")
-		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		for _, name := range []string{name, chunksName(name)} {
+			err = os.Rename(name, name+".bak")
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if chunks != "" {
+		if err = os.Rename(chunks, chunksName(name)); err != nil {
 			return err
 		}
 	}
-	return os.Rename(f.Name(), name)
+	return os.Rename(tmp, name)
+}
+
+// writeTemp calls write to write a new temporary file in the same directory as
+// name and returns the temporary file name.
+func writeTemp(name string, write func(io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return "", err
+	}
+	if err = write(f); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
 }
 
 // Read reads index contents from src.
@@ -111,9 +158,62 @@ func read(src io.Reader) (*Index, error) {
 	if err != nil {
 		return nil, err
 	}
+	var alg Algorithm
+	var secondary []Algorithm
+	var chunkSize int
+	var mtime TimeTolerance
+	var errs []*FileError
+	var alloc map[path]int64
+	var sums map[Digest]Sums
 	var g Files
 	groups := make([]Files, 0, 512)
 	for ; s.Scan(); line++ {
+		if b := s.Bytes(); len(b) > 0 && b[0] == '@' && len(groups) == 0 && len(g) == 0 {
+			// Header attribute
+			name, val, _ := strings.Cut(string(b[1:]), " ")
+			switch name {
+			case attrHash:
+				if err = alg.Set(val); err == nil && !alg.IsPrimary() {
+					err = fmt.Errorf("index: not a primary hash algorithm on line %d (%v)", line, alg)
+				}
+			case attrSecondary:
+				secondary, err = ParseAlgorithms(val)
+			case attrChunks:
+				if chunkSize, err = strconv.Atoi(val); err == nil {
+					err = validChunkSize(chunkSize)
+				}
+			case attrMTime:
+				err = mtime.Set(val)
+			default:
+				err = fmt.Errorf("index: unsupported attribute on line %d (%s)", line, name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if b := s.Bytes(); len(b) > 0 && b[0] == '!' && len(groups) == 0 && len(g) == 0 {
+			// Error entry
+			kind, p, _ := strings.Cut(string(b[1:]), "\t")
+			if kind == "" || p == "" || cleanPath(p) != p {
+				return nil, fmt.Errorf("index: invalid error entry on line %d", line)
+			}
+			errs = append(errs, fileError(ErrorKind(kind), p, nil))
+			continue
+		}
+		if b := s.Bytes(); len(b) > 0 && b[0] == '%' && len(groups) == 0 && len(g) == 0 {
+			// Sparse file entry
+			n, p, _ := strings.Cut(string(b[1:]), "\t")
+			v, err := strconv.ParseUint(n, 10, 63)
+			if c := path(cleanPath(p)); err != nil || c != path(p) || !c.isFile() {
+				return nil, fmt.Errorf("index: invalid sparse file entry on line %d", line)
+			}
+			if alloc == nil {
+				alloc = make(map[path]int64)
+			}
+			alloc[path(p)] = int64(v)
+			continue
+		}
 		ln, ok := bytes.CutPrefix(s.Bytes(), []byte("\t\t"))
 		if !ok {
 			// Flags
@@ -151,20 +251,42 @@ func read(src io.Reader) (*Index, error) {
 
 		// Digest
 		digest, ln, ok := cutByte(ln, '\t')
-		n, err := hex.Decode(g[0].digest[:], digest)
-		if !ok || n != len(Digest{}) || err != nil {
+		n, err := hex.Decode(g[0].digest[:], digest[:min(len(digest), 2*len(Digest{}))])
+		if !ok || n != len(Digest{}) || len(digest) != 2*n || err != nil {
 			return nil, fmt.Errorf("index: invalid digest on line %d", line)
 		}
 
 		// Size
-		v, err := strconv.ParseUint(unsafeString(ln), 10, 63)
+		size, ln, more := cutByte(ln, '\t')
+		v, err := strconv.ParseUint(unsafeString(size), 10, 63)
 		if g[0].size = int64(v); err != nil {
 			return nil, fmt.Errorf("index: invalid size on line %d", line)
 		}
 
-		// Copy digest and size
+		// Partial digest marker and secondary digests
+		for more {
+			var attr []byte
+			if attr, ln, more = cutByte(ln, '\t'); unsafeString(attr) == groupPartial {
+				g[0].flag |= flagPartial
+				continue
+			}
+			a, d, err := parseSum(string(attr))
+			if err != nil {
+				return nil, fmt.Errorf("index: invalid group attribute on line %d (%s)", line, attr)
+			}
+			if sums[g[0].digest] == nil {
+				if sums == nil {
+					sums = make(map[Digest]Sums)
+				}
+				sums[g[0].digest] = make(Sums)
+			}
+			sums[g[0].digest][a] = d
+		}
+
+		// Copy digest, size, and partial marker
 		for _, f := range g[1:] {
 			f.digest, f.size = g[0].digest, g[0].size
+			f.flag |= g[0].flag & flagPartial
 		}
 		groups, g = append(groups, g[:len(g):len(g)]), g[len(g):]
 	}
@@ -174,10 +296,31 @@ func read(src io.Reader) (*Index, error) {
 	if len(g) != 0 {
 		return nil, fmt.Errorf("index: incomplete final group")
 	}
-	return &Index{root, groups}, nil
+	if err = validSecondary(alg, secondary); err != nil {
+		return nil, err
+	}
+	x := &Index{root: root, hash: alg, mtime: mtime, errs: errs, alloc: alloc, groups: groups, secondary: secondary, chunkSize: chunkSize}
+	x.setSums(sums)
+	return x, nil
 }
 
-const v1 = "fsx index v1"
+// Index file signatures. Version 2 added header attributes, error, sparse
+// file, and partial group lines. Version 1 files are still accepted.
+const (
+	v1 = "fsx index v1"
+	v2 = "fsx index v2"
+)
+
+// Header attribute names.
+const (
+	attrHash      = "hash"      // Hash algorithm
+	attrSecondary = "secondary" // Secondary digest algorithms
+	attrChunks    = "chunks"    // Average content-defined chunk size
+	attrMTime     = "mtime"     // Modification time tolerance
+)
+
+// groupPartial marks groups whose digest does not cover full file contents.
+const groupPartial = "partial"
 
 // readHeader reads the index version and root path lines from s.
 func readHeader(s *bufio.Scanner) (line int, root string, err error) {
@@ -185,7 +328,7 @@ func readHeader(s *bufio.Scanner) (line int, root string, err error) {
 		err = fmt.Errorf("index: missing signature: %w", s.Err())
 		return
 	}
-	if sig := unsafeString(s.Bytes()); sig != v1 {
+	if sig := unsafeString(s.Bytes()); sig != v2 && sig != v1 {
 		err = fmt.Errorf("index: invalid signature: %s", sig)
 		return
 	}
@@ -231,6 +374,21 @@ func (x *Index) write(dst io.Writer) error {
 
 	w := bufio.NewWriter(dst)
 	x.writeHeader(w)
+	for _, e := range x.errs {
+		_ = w.WriteByte('!')
+		_, _ = w.WriteString(string(e.Kind))
+		_ = w.WriteByte('\t')
+		_, _ = w.WriteString(e.Path)
+		_ = w.WriteByte('\n')
+	}
+	sparse := make([]path, 0, len(x.alloc))
+	for p := range x.alloc {
+		sparse = append(sparse, p)
+	}
+	slices.SortFunc(sparse, path.cmp)
+	for _, p := range sparse {
+		_, _ = fmt.Fprintf(w, "%%%d\t%s\n", x.alloc[p], p)
+	}
 	lineWidth := make([]int, 0, 16)
 	for _, g := range x.groups {
 		// Calculate path widths
@@ -244,7 +402,7 @@ func (x *Index) write(dst io.Writer) error {
 			} else {
 				lineWidth = append(lineWidth, 0)
 			}
-			if f.digest != g[0].digest || f.size != g[0].size {
+			if f.digest != g[0].digest || f.size != g[0].size || (f.flag^g[0].flag)&flagPartial != 0 {
 				panic(fmt.Sprint("index: group digest/size mismatch: ", f))
 			}
 		}
@@ -283,6 +441,12 @@ func (x *Index) write(dst io.Writer) error {
 		// Size
 		b = append(buf(w, len("\t18446744073709551615")), '\t')
 		_, _ = w.Write(strconv.AppendUint(b, uint64(g[0].size), 10))
+		if g[0].flag.IsPartial() {
+			_ = w.WriteByte('\t')
+			_, _ = w.WriteString(groupPartial)
+		} else if s := x.sums[g[0].digest]; s != nil {
+			_, _ = w.Write(appendSums(buf(w, 0)[:0], s))
+		}
 		if err := w.WriteByte('\n'); err != nil {
 			return err
 		}
@@ -290,17 +454,56 @@ func (x *Index) write(dst io.Writer) error {
 	return w.Flush()
 }
 
-// writeHeader writes the index version and root path to w.
+// writeHeader writes the index version, root path, and any attributes to w.
 func (x *Index) writeHeader(w *bufio.Writer) {
-	_, _ = w.WriteString(v1)
+	_, _ = w.WriteString(v2)
 	_ = w.WriteByte('\n')
 	_, _ = w.WriteString(x.root)
 	_ = w.WriteByte('\n')
+	if x.hash != BLAKE3 {
+		_, _ = fmt.Fprintf(w, "@%s %s\n", attrHash, x.hash)
+	}
+	if len(x.secondary) > 0 {
+		_, _ = fmt.Fprintf(w, "@%s %s\n", attrSecondary, FormatAlgorithms(x.secondary))
+	}
+	if x.chunkSize != 0 {
+		_, _ = fmt.Fprintf(w, "@%s %d\n", attrChunks, x.chunkSize)
+	}
+	if !x.mtime.IsExact() {
+		_, _ = fmt.Fprintf(w, "@%s %s\n", attrMTime, x.mtime)
+	}
 }
 
 // Root returns the index root directory.
 func (x *Index) Root() string { return x.root }
 
+// Hash returns the hash algorithm of file digests.
+func (x *Index) Hash() Algorithm { return x.hash }
+
+// MTime returns the modification time tolerance that was used to create the
+// index.
+func (x *Index) MTime() TimeTolerance { return x.mtime }
+
+// Errors returns all paths that could not be indexed, such as unreadable files
+// and directories. Directory paths end with a '/'. Errors of kind ModifiedErr
+// identify volatile files that were being modified while the index was created.
+func (x *Index) Errors() []*FileError { return x.errs }
+
+// Allocated returns the number of bytes allocated for file f on disk. This is
+// less than its size if it is a sparse file. Otherwise, the size is returned.
+func (x *Index) Allocated(f *File) int64 {
+	if a, ok := x.alloc[f.path]; ok && !f.flag.IsGone() {
+		return a
+	}
+	return f.size
+}
+
+// setErrs sorts errs by path and assigns them to x.
+func (x *Index) setErrs(errs []*FileError) {
+	slices.SortFunc(errs, func(a, b *FileError) int { return strings.Compare(a.Path, b.Path) })
+	x.errs = errs
+}
+
 // Files returns all files.
 func (x *Index) Files() Files {
 	var n int
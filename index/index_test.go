@@ -2,13 +2,14 @@ package index
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-const testIdx = `fsx index v1
+const testIdx = `fsx index v2
 /
 K	d1/a	//											2009-11-10T23:00:00Z
 	d2/a
@@ -31,19 +32,19 @@ func TestIndexReadWrite(t *testing.T) {
 	want := &Index{
 		root: "/",
 		groups: []Files{{
-			{"d1/a", d1, 1, t0, flagKeep},
-			{"d2/a", d1, 1, t0, flagNone},
-			{"a", d1, 1, t0, flagNone},
+			{"d1/a", d1, 1, t0, flagKeep, nil},
+			{"d2/a", d1, 1, t0, flagNone, nil},
+			{"a", d1, 1, t0, flagNone, nil},
 		}, {
-			{"b", d2, 2, t1, flagNone},
-			{"gone1", d2, 2, t1, flagGone},
+			{"b", d2, 2, t1, flagNone, nil},
+			{"gone1", d2, 2, t1, flagGone, nil},
 		}, {
-			{"gone2", d2, 2, t1, flagGone},
+			{"gone2", d2, 2, t1, flagGone, nil},
 		}, {
-			{"c", d3, 3, t0, flagNone},
-			{"d\t", d3, 3, t0, flagDup},
-			{"e \t", d3, 3, t1, flagDup | flagGone},
-			{"f", d3, 3, t1, flagNone},
+			{"c", d3, 3, t0, flagNone, nil},
+			{"d\t", d3, 3, t0, flagDup, nil},
+			{"e \t", d3, 3, t1, flagDup | flagGone, nil},
+			{"f", d3, 3, t1, flagNone, nil},
 		}},
 	}
 
@@ -57,6 +58,11 @@ func TestIndexReadWrite(t *testing.T) {
 	want.groups = append(want.groups[:2], want.groups[3])
 	require.Equal(t, want, have)
 
+	// Version 1 files are still accepted
+	have, err = read(bytes.NewBufferString(strings.Replace(testIdx, v2, v1, 1)))
+	require.NoError(t, err)
+	require.Equal(t, want, have)
+
 	// Roundtrip with compression
 	buf.Reset()
 	require.NoError(t, want.Write(&buf))
@@ -64,3 +70,37 @@ func TestIndexReadWrite(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, want, have)
 }
+
+func TestIndexAttrs(t *testing.T) {
+	want := &Index{
+		root:   "/",
+		hash:   SHA512_256,
+		mtime:  TimeTolerance{Window: 2 * time.Second, Trunc: true},
+		errs:   []*FileError{{ModifiedErr, "a/b", nil}},
+		alloc:  map[path]int64{"b/c": 4096, "a": 0},
+		groups: []Files{},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, want.write(&buf))
+	require.Equal(t, "fsx index v2\n/\n@hash sha512/256\n@mtime window=2s,trunc\n!modified-while-reading\ta/b\n%4096\tb/c\n%0\ta\n", buf.String())
+	have, err := read(&buf)
+	require.NoError(t, err)
+	require.Equal(t, want, have)
+
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@x y\n"))
+	require.ErrorContains(t, err, "unsupported attribute")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@mtime hours=x\n"))
+	require.Error(t, err)
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@hash sha3\n"))
+	require.ErrorContains(t, err, "unsupported hash algorithm")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@hash md5\n"))
+	require.ErrorContains(t, err, "not a primary hash algorithm")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@secondary md5,md5\n"))
+	require.ErrorContains(t, err, "invalid secondary hash algorithm")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n@chunks 5000\n"))
+	require.ErrorContains(t, err, "invalid average chunk size")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n!read\t../a\n"))
+	require.ErrorContains(t, err, "invalid error entry")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n%1\ta/\n"))
+	require.ErrorContains(t, err, "invalid sparse file entry")
+}
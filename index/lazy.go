@@ -0,0 +1,248 @@
+package index
+
+import (
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// lazyWindow is the number of bytes at the start and end of a file that are
+// used to compute its partial digest.
+const lazyWindow = 64 * 1024
+
+// partialHash is the key derivation context for partial digests, which keeps
+// them distinct from full content digests.
+const partialHash = "github.com/mxk/fsx partial file digest v1"
+
+// stat returns a file with a partial digest derived from its name, size, and
+// modification time, which is unique until the file is compared to others of
+// the same size. Empty files are hashed normally.
+func (h *Hasher) stat(fsys fs.FS, name string) (*File, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, fileError(StatErr, name, err)
+	}
+	if fi.Size() == 0 {
+		return h.Read(fsys, name, true)
+	}
+	if a, ok := sparseSize(fsys, name, fi); ok {
+		h.alloc = a
+	} else {
+		h.alloc = -1
+	}
+	var hdr [17]byte
+	binary.LittleEndian.PutUint64(hdr[1:], uint64(fi.Size()))
+	binary.LittleEndian.PutUint64(hdr[9:], uint64(fi.ModTime().UnixNano()))
+	ph := blake3.NewDeriveKey(partialHash)
+	_, _ = ph.Write(hdr[:])
+	_, _ = ph.WriteString(name)
+	var d Digest
+	ph.Sum(d[:0])
+	return &File{strictFilePath(name), d, fi.Size(), fi.ModTime(), flagPartial, nil}, nil
+}
+
+// readPartial computes the partial digest of file f from its size and the
+// first and last lazyWindow bytes. The file must be larger than 2*lazyWindow
+// and must have the same size and modification time (within tol) as f.
+func (h *Hasher) readPartial(fsys fs.FS, tol TimeTolerance, f *File) (*File, error) {
+	name := string(f.path)
+	r, err := fsys.Open(name)
+	if err != nil {
+		return nil, fileError(OpenErr, name, err)
+	}
+	defer func() { _ = r.Close() }()
+	fi, err := r.Stat()
+	if err != nil {
+		return nil, fileError(StatErr, name, err)
+	}
+	if !f.isSame(tol, fi, nil) {
+		return nil, fileError(ModifiedErr, name, nil)
+	}
+	ph := blake3.NewDeriveKey(partialHash)
+	var hdr [9]byte
+	hdr[0] = 1
+	binary.LittleEndian.PutUint64(hdr[1:], uint64(f.size))
+	_, _ = ph.Write(hdr[:])
+	if err = readEnds(ph, ph, r, f.size, lazyWindow, lazyWindow, h.b[:]); err != nil {
+		return nil, fileError(ReadErr, name, err)
+	}
+	if h.m != nil {
+		if err = h.m(2 * lazyWindow); err != nil {
+			return nil, err
+		}
+	}
+	var d Digest
+	ph.Sum(d[:0])
+	return &File{f.path, d, f.size, fi.ModTime(), flagPartial, nil}, nil
+}
+
+// readEnds copies the first head bytes of r, which contains size bytes, to hw
+// and the last tail bytes to tw. The ends must not overlap.
+func readEnds(hw, tw io.Writer, r io.Reader, size, head, tail int64, buf []byte) error {
+	copyN := func(w io.Writer, n int64) error {
+		m, err := io.CopyBuffer(w, io.LimitReader(r, n), buf)
+		if err == nil && m != n {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := copyN(hw, head); err != nil {
+		return err
+	}
+	var err error
+	if s, ok := r.(io.Seeker); ok {
+		_, err = s.Seek(-tail, io.SeekEnd)
+	} else {
+		_, err = io.CopyN(io.Discard, r, size-head-tail)
+	}
+	if err != nil {
+		return err
+	}
+	return copyN(tw, tail)
+}
+
+// resolve replaces the partial digests of files in all that may have copies.
+// Files with unique sizes keep their name-based digests. Same-size files are
+// compared by the partial digests of their first and last lazyWindow bytes, and
+// only those that still match are fully hashed. Small files are fully hashed
+// without the partial comparison. Errors are passed to errFn. Files that could
+// not be read keep their existing digests, which never match other files.
+func (w *walker) resolve(cp ctxPoller, all Files, mon func(int) error, tick func(), errFn func(error)) {
+	bySize := make(map[int64][]int)
+	for i, f := range all {
+		if f.size > 0 && !f.flag.IsGone() {
+			bySize[f.size] = append(bySize[f.size], i)
+		}
+	}
+	var cand, full []int
+	for size, g := range bySize {
+		if len(g) < 2 || !anyPartial(all, g) {
+			continue
+		}
+		if size > 2*lazyWindow {
+			cand = append(cand, g...)
+			continue
+		}
+		for _, i := range g {
+			if all[i].flag.IsPartial() {
+				full = append(full, i)
+			}
+		}
+	}
+
+	// Compare candidates by their partial digests. Files with full digests are
+	// included so that they can be matched with partial ones.
+	part := make([]*File, len(cand))
+	w.parallel(cp, len(cand), mon, tick, errFn, func(h *Hasher, j int) (err error) {
+		part[j], err = h.readPartial(w.fsys, w.MTime, all[cand[j]])
+		return
+	})
+	byPart := make(map[Digest][]int)
+	for j, f := range part {
+		if f != nil {
+			byPart[f.digest] = append(byPart[f.digest], j)
+		}
+	}
+	for _, g := range byPart {
+		for _, j := range g {
+			if i := cand[j]; all[i].flag.IsPartial() {
+				if len(g) == 1 {
+					all[i] = resolved(all[i], part[j])
+				} else {
+					full = append(full, i)
+				}
+			}
+		}
+	}
+
+	// Fully hash files that may still have copies
+	w.parallel(cp, len(full), mon, tick, errFn, func(h *Hasher, j int) error {
+		f, err := w.read(cp, h, string(all[full[j]].path))
+		if err == nil {
+			all[full[j]] = resolved(all[full[j]], f)
+			w.addSums(f.digest, h.Sums())
+			w.addChunks(f, h.Chunks())
+		}
+		return err
+	})
+}
+
+// anyPartial returns whether any of the files in all at indices g have partial
+// digests.
+func anyPartial(all Files, g []int) bool {
+	for _, i := range g {
+		if all[i].flag.IsPartial() {
+			return true
+		}
+	}
+	return false
+}
+
+// resolved returns the new version of file f, preserving its persistent flags.
+func resolved(f, cur *File) *File {
+	cur.flag = f.flag&flagPersist | cur.flag&flagPartial
+	return cur
+}
+
+// parallel calls fn with indices in the range [0,n) using a separate Hasher for
+// each CPU. Errors are passed to errFn from the calling goroutine. If tick is
+// non-nil, it is called every second until all calls return.
+func (s *Scanner) parallel(cp ctxPoller, n int, mon func(int) error, tick func(), errFn func(error), fn func(h *Hasher, i int) error) {
+	if n == 0 {
+		return
+	}
+	next := make(chan int)
+	errc := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := min(runtime.NumCPU(), n); i > 0; i-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := s.newHasher(mon)
+			for i := range next {
+				if err := fn(h, i); err != nil && !cp.canceled() {
+					errc <- err
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer func() {
+			wg.Wait()
+			close(done)
+		}()
+		defer close(next)
+		for i := 0; i < n && !cp.canceled(); i++ {
+			next <- i
+		}
+	}()
+	var tc <-chan time.Time
+	if tick != nil {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		tc = t.C
+	}
+	for {
+		select {
+		case err := <-errc:
+			errFn(err)
+		case <-tc:
+			tick()
+		case <-done:
+			for {
+				select {
+				case err := <-errc:
+					errFn(err)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
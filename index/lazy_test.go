@@ -0,0 +1,76 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/blake3"
+)
+
+func TestScanLazy(t *testing.T) {
+	large := func(i int, b byte) []byte {
+		p := make([]byte, 3*lazyWindow)
+		p[i] = b
+		return p
+	}
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a": {Data: []byte("unique"), ModTime: t0},
+		"b": {Data: []byte("small b"), ModTime: t0},
+		"c": {Data: []byte("small c"), ModTime: t0},
+		"d": {Data: large(0, 1), ModTime: t0},
+		"e": {Data: large(0, 2), ModTime: t0},
+		"f": {Data: large(lazyWindow, 1), ModTime: t0},
+		"g": {Data: large(lazyWindow, 2), ModTime: t0},
+		"h": {Data: large(3*lazyWindow-1, 1), ModTime: t0},
+		"i": {Data: large(3*lazyWindow-1, 1), ModTime: t0},
+		"j": {Data: nil, ModTime: t0},
+	}
+	x, err := (&Scanner{Lazy: true}).Scan(context.Background(), fsys)
+	require.NoError(t, err)
+
+	partial := map[string]bool{"a": true, "d": true, "e": true}
+	digests := make(map[Digest]int)
+	for _, f := range x.Files() {
+		name := string(f.path)
+		assert.Equal(t, partial[name], f.flag.IsPartial(), "%s", name)
+		if !partial[name] && f.size > 0 {
+			assert.Equal(t, Digest(blake3.Sum256(fsys[name].Data)), f.digest, "%s", name)
+		}
+		digests[f.digest]++
+	}
+	assert.Len(t, digests, len(fsys)-1)
+	assert.Equal(t, 2, digests[blake3.Sum256(fsys["h"].Data)])
+
+	// Partial digests are preserved in the index
+	var buf bytes.Buffer
+	require.NoError(t, x.write(&buf))
+	assert.Contains(t, buf.String(), "\t6\tpartial\n")
+	y, err := read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, x.Files(), y.Files())
+
+	// Lazy rescan reuses partial digests until there is a possible copy
+	fsys["k"] = &fstest.MapFile{Data: []byte("unique"), ModTime: t0}
+	x, err = (&Scanner{Lazy: true}).Rescan(context.Background(), y.ToTree(), fsys)
+	require.NoError(t, err)
+	for _, f := range x.Files() {
+		assert.Equal(t, f.path == "d" || f.path == "e", f.flag.IsPartial(), "%s", f.path)
+	}
+	assert.Equal(t, x.ToTree().file("a").digest, x.ToTree().file("k").digest)
+
+	// Regular rescan computes full digests
+	x, err = (&Scanner{}).Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	for _, f := range x.Files() {
+		assert.False(t, f.flag.IsPartial(), "%s", f.path)
+		if f.size > 0 {
+			assert.Equal(t, Digest(blake3.Sum256(fsys[string(f.path)].Data)), f.digest, "%s", f.path)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// ManifestEntry is a file digest listed in a manifest compatible with b3sum,
+// sha256sum, and similar tools.
+type ManifestEntry struct {
+	Sum  []byte
+	Name string
+}
+
+// ReadManifest reads all entries from manifest r. It returns the number of
+// non-empty lines that could not be parsed.
+func ReadManifest(r io.Reader) (all []ManifestEntry, invalid int, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if e, ok := ParseManifestLine(s.Text()); ok {
+			all = append(all, e)
+		} else if strings.TrimSpace(s.Text()) != "" {
+			invalid++
+		}
+	}
+	return all, invalid, s.Err()
+}
+
+// ParseManifestLine parses a "<hex>  <name>" manifest line. Lines that begin
+// with a backslash have escaped names. A '*' binary mode marker in place of the
+// second space is also accepted.
+func ParseManifestLine(ln string) (e ManifestEntry, ok bool) {
+	esc := strings.HasPrefix(ln, `\`)
+	if esc {
+		ln = ln[1:]
+	}
+	sum, name, ok := strings.Cut(ln, " ")
+	if !ok || len(sum) == 0 || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+		return e, false
+	}
+	var err error
+	if e.Sum, err = hex.DecodeString(sum); err != nil {
+		return e, false
+	}
+	if e.Name = name[1:]; esc {
+		e.Name, ok = unescapeName(e.Name)
+	}
+	return e, ok
+}
+
+// AppendManifestLine appends a manifest line for the specified digest and file
+// name, including the final LF.
+func AppendManifestLine(b, sum []byte, name string) []byte {
+	name, esc := EscapeManifestName(name)
+	if esc {
+		b = append(b, '\\')
+	}
+	b = append(b, hex.EncodeToString(sum)...)
+	b = append(b, "  "...)
+	b = append(b, name...)
+	return append(b, '\n')
+}
+
+// nameEscaper escapes file names in manifests.
+var nameEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// EscapeManifestName escapes backslashes and line breaks in name. It returns
+// whether any characters were escaped, in which case the manifest line must
+// begin with a backslash.
+func EscapeManifestName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	return nameEscaper.Replace(name), true
+}
+
+// unescapeName reverses EscapeManifestName.
+func unescapeName(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// FromManifest creates an index of fsys from manifest entries with names
+// relative to the root of fsys. File sizes are read from fsys. Modification
+// times are also read from fsys if modTimes is true, trusting that the files
+// were not modified since the manifest was created. Otherwise, they are left
+// unknown (zero), which causes the files to be hashed again by the next
+// update. Digests of empty files are replaced with name-based digests. Files
+// that cannot be added are reported to errFn and, if they exist, recorded as
+// index errors.
+func FromManifest(fsys fs.FS, entries []ManifestEntry, alg Algorithm, modTimes bool, errFn func(error)) *Index {
+	s := &Scanner{Hash: alg, ErrFn: errFn}
+	h := alg.NewHasher(nil)
+	seen := make(map[path]struct{}, len(entries))
+	var all Files
+	var errs []*FileError
+	for _, e := range entries {
+		p := path(cleanPath(e.Name))
+		if !p.isFile() || !validName(string(p)) {
+			errs = s.fileErr(errs, fileError(PathErr, e.Name, nil))
+			continue
+		}
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		if len(e.Sum) != len(Digest{}) {
+			errs = s.fileErr(errs, fmt.Errorf("index: invalid %v digest for %s", alg, p))
+			continue
+		}
+		fi, err := fs.Stat(fsys, string(p))
+		if err != nil {
+			errs = s.fileErr(errs, fileError(StatErr, string(p), err))
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			errs = s.fileErr(errs, fileError(TypeErr, string(p), nil))
+			continue
+		}
+		var f *File
+		if fi.Size() == 0 {
+			if f, err = h.Read(fsys, string(p), true); err != nil {
+				errs = s.fileErr(errs, err)
+				continue
+			}
+		} else {
+			f = &File{p, Digest(e.Sum), fi.Size(), fi.ModTime(), flagNone, nil}
+		}
+		if !modTimes {
+			f.modTime = time.Time{}
+		}
+		all = append(all, f)
+	}
+	all.Sort()
+	x := New(dirFSRoot(fsys), all)
+	x.hash = alg
+	x.setErrs(errs)
+	return x
+}
+
+// WriteManifest writes a manifest of all existing files with alg digests to w.
+// File names are relative to the index root. The alg may be the primary or a
+// secondary algorithm. Files with partial digests or without secondary alg
+// digests are skipped, and their number is returned.
+func (x *Index) WriteManifest(w io.Writer, alg Algorithm) (skipped int, err error) {
+	empty := alg.new().Sum(nil)
+	bw := bufio.NewWriter(w)
+	for _, f := range x.Files() {
+		if f.flag.IsGone() {
+			continue
+		}
+		var sum []byte
+		switch {
+		case f.flag.IsPartial():
+		case f.size == 0:
+			sum = empty
+		case alg == x.hash:
+			sum = f.digest[:]
+		default:
+			sum = x.Sums(f)[alg]
+		}
+		if sum == nil {
+			skipped++
+			continue
+		}
+		if _, err = bw.Write(AppendManifestLine(bw.AvailableBuffer(), sum, string(f.path))); err != nil {
+			return
+		}
+	}
+	return skipped, bw.Flush()
+}
@@ -0,0 +1,82 @@
+package index
+
+import (
+	"bytes"
+	"crypto/md5"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/blake3"
+)
+
+func TestManifestLine(t *testing.T) {
+	for _, name := range []string{"a", "a b", `a\b`, "a\nb\r", " a"} {
+		ln := string(AppendManifestLine(nil, []byte{0xAB}, name))
+		assert.Equal(t, strings.ContainsAny(name, "\\\n\r"), ln[0] == '\\', "%q", ln)
+		e, ok := ParseManifestLine(strings.TrimSuffix(ln, "\n"))
+		require.True(t, ok, "%q", ln)
+		assert.Equal(t, ManifestEntry{[]byte{0xAB}, name}, e)
+	}
+	e, ok := ParseManifestLine("ab *a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", e.Name)
+	for _, ln := range []string{"", "ab", "ab a", "xy  a", `\ab  a\b`, "ab  "} {
+		_, ok = ParseManifestLine(ln)
+		assert.False(t, ok, "%q", ln)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a":   {Data: []byte("a"), ModTime: t0},
+		"b/c": {Data: []byte("c"), ModTime: t0},
+		"e":   {ModTime: t0},
+	}
+	da, dc := blake3.Sum256([]byte("a")), blake3.Sum256([]byte("c"))
+	de := blake3.Sum256(nil)
+	all, invalid, err := ReadManifest(strings.NewReader(string(
+		AppendManifestLine(nil, da[:], "./a")) +
+		string(AppendManifestLine(nil, dc[:], "b/c")) +
+		string(AppendManifestLine(nil, de[:], "e")) +
+		string(AppendManifestLine(nil, da[:], "missing")) +
+		string(AppendManifestLine(nil, da[:], "../x")) +
+		"invalid\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, invalid)
+	require.Len(t, all, 5)
+
+	var errs []error
+	x := FromManifest(fsys, all, BLAKE3, true, func(err error) { errs = append(errs, err) })
+	assert.Len(t, errs, 2)
+	files := x.Files()
+	require.Len(t, files, 3)
+	assert.Equal(t, &File{"a", da, 1, t0, flagNone, nil}, x.ToTree().file("a"))
+	assert.Equal(t, Digest(blake3.Sum256([]byte("e"))), x.ToTree().file("e").digest)
+
+	x = FromManifest(fsys, all, BLAKE3, false, nil)
+	assert.True(t, x.ToTree().file("a").modTime.IsZero())
+
+	// Exported manifest uses real digests of empty files
+	var buf bytes.Buffer
+	skipped, err := x.WriteManifest(&buf, BLAKE3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, skipped)
+	want := string(AppendManifestLine(nil, dc[:], "b/c")) +
+		string(AppendManifestLine(nil, da[:], "a")) +
+		string(AppendManifestLine(nil, de[:], "e"))
+	assert.Equal(t, want, buf.String())
+
+	// Secondary digests
+	x.sums = map[Digest]Sums{da: {MD5: []byte{1}}}
+	buf.Reset()
+	skipped, err = x.WriteManifest(&buf, MD5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+	me := md5.Sum(nil)
+	assert.Equal(t, "01  a\n"+string(AppendManifestLine(nil, me[:], "e")), buf.String())
+}
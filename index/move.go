@@ -0,0 +1,90 @@
+package index
+
+import "io/fs"
+
+// moves finds files that were moved to a new path since the tree was last
+// scanned. Index files do not record inode numbers, so a file is considered
+// moved if its size and modification time (within the scanner's tolerance)
+// match a file that no longer exists at its original path. If there are
+// multiple such files, the one with the same base name is chosen. Otherwise,
+// the match is ambiguous and the file must be hashed.
+type moves map[int64]Files
+
+// newMoves returns the move candidates in the sub directory of t. Empty files
+// are excluded because their digests depend on the file name. Files with
+// partial digests are excluded because they are cheap to index again. Files
+// without all secondary digests or chunks required by s are excluded because
+// they must be read anyway.
+func newMoves(t *Tree, sub path, s *Scanner) moves {
+	m := make(moves)
+	for _, g := range t.idx {
+		for _, f := range g {
+			if f.size > 0 && !f.flag.IsGone() && !f.flag.IsPartial() && sub.contains(f.path) &&
+				t.reusable(f, s) {
+				m[f.size] = append(m[f.size], f)
+			}
+		}
+	}
+	return m
+}
+
+// find returns a new file that reuses the digest and flags of the file that
+// was moved to name, or nil if there is no unique match. If check is non-nil,
+// it must also report that the contents of name match the original file. The
+// original file is marked with flagSame to exclude it from the new index.
+func (m moves) find(fsys fs.FS, tol TimeTolerance, name string, fi fs.FileInfo, check func(name string, f *File) bool) *File {
+	var match *File
+	var n int
+	for _, f := range m[fi.Size()] {
+		if f.flag&flagSame != 0 || string(f.path) == name || !tol.Equal(fi.ModTime(), f.modTime) {
+			continue // Already claimed, modified in place, or different modtime
+		}
+		if cur, err := fs.Stat(fsys, string(f.path)); f.isSame(tol, cur, err) {
+			continue // Copied
+		}
+		if n++; match == nil || (f.base() == fi.Name() && match.base() != fi.Name()) {
+			match = f
+		} else if f.base() == fi.Name() {
+			return nil // Multiple candidates with the same name
+		}
+	}
+	if n == 0 || (n > 1 && match.base() != fi.Name()) || (check != nil && !check(name, match)) {
+		return nil
+	}
+	match.flag |= flagSame
+	return &File{strictFilePath(name), match.digest, match.size, fi.ModTime(), match.flag&flagPersist | flagSame, match.sums}
+}
+
+// checkMove reports whether the first and last chunks of file name match the
+// chunks cs of the file that it was moved from. This is a quick partial
+// content check that reads at most two chunks. It returns false if cs is empty.
+func (h *Hasher) checkMove(fsys fs.FS, name string, cs []Chunk) bool {
+	if len(cs) == 0 {
+		return false
+	}
+	r, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = r.Close() }()
+	var size int64
+	for _, c := range cs {
+		size += c.Size
+	}
+	first, last := cs[0], Chunk{}
+	if len(cs) > 1 {
+		last = cs[len(cs)-1]
+	}
+	h.h.Reset()
+	th := h.alg.new()
+	if readEnds(h.writer(), th, r, size, first.Size, last.Size, h.b[:]) != nil ||
+		h.digest() != first.Digest {
+		return false
+	}
+	if last.Size == 0 {
+		return true
+	}
+	var d Digest
+	th.Sum(d[:0])
+	return d == last.Digest
+}
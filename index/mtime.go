@@ -0,0 +1,96 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeTolerance specifies how closely file modification times must match for
+// a file to be considered unchanged. The zero value requires an exact match.
+// Tolerances are needed when an indexed tree is copied or moved to a file
+// system that stores timestamps with less precision or with a different time
+// zone interpretation.
+type TimeTolerance struct {
+	Window time.Duration // Maximum difference (e.g. 2s for FAT)
+	Hours  int           // Maximum whole-hour offset (e.g. 1 for DST shifts)
+	Trunc  bool          // Ignore sub-second precision
+}
+
+// IsExact returns whether modification times must match exactly.
+func (t TimeTolerance) IsExact() bool { return t == TimeTolerance{} }
+
+// Equal returns whether modification times a and b match within the
+// tolerance.
+func (t TimeTolerance) Equal(a, b time.Time) bool {
+	if t.Trunc {
+		a, b = a.Truncate(time.Second), b.Truncate(time.Second)
+	}
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	if t.Hours > 0 {
+		h := min((d+time.Hour/2)/time.Hour, time.Duration(t.Hours))
+		if d -= h * time.Hour; d < 0 {
+			d = -d
+		}
+	}
+	return d <= t.Window
+}
+
+// String returns the tolerance in the format accepted by Set.
+func (t TimeTolerance) String() string {
+	var b []string
+	if t.Window != 0 {
+		b = append(b, "window="+t.Window.String())
+	}
+	if t.Hours != 0 {
+		b = append(b, "hours="+strconv.Itoa(t.Hours))
+	}
+	if t.Trunc {
+		b = append(b, "trunc")
+	}
+	return strings.Join(b, ",")
+}
+
+// Set parses a comma-separated list of tolerance terms: "window=<duration>",
+// "hours=<n>", and "trunc". The name "fat" is shorthand for "window=2s". An
+// empty string requires an exact match.
+func (t *TimeTolerance) Set(s string) error {
+	var v TimeTolerance
+	for _, term := range strings.Split(s, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(term), "=")
+		var err error
+		switch key {
+		case "":
+			continue
+		case "window":
+			v.Window, err = time.ParseDuration(val)
+			if err == nil && v.Window < 0 {
+				err = fmt.Errorf("negative window")
+			}
+		case "hours":
+			v.Hours, err = strconv.Atoi(val)
+			if err == nil && (v.Hours < 0 || 24 < v.Hours) {
+				err = fmt.Errorf("hours out of range")
+			}
+		case "trunc", "fat":
+			if val != "" {
+				err = fmt.Errorf("unexpected value")
+			} else if key == "trunc" {
+				v.Trunc = true
+			} else {
+				v.Window = 2 * time.Second
+			}
+		default:
+			err = fmt.Errorf("unknown term")
+		}
+		if err != nil {
+			return fmt.Errorf("index: invalid time tolerance %q (%v)", term, err)
+		}
+	}
+	*t = v
+	return nil
+}
@@ -0,0 +1,78 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeTolerance(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		tol  string
+		d    time.Duration
+		want bool
+	}{
+		{"", 0, true},
+		{"", time.Nanosecond, false},
+		{"fat", 2 * time.Second, true},
+		{"fat", -2 * time.Second, true},
+		{"fat", 2*time.Second + 1, false},
+		{"trunc", 400 * time.Millisecond, true},
+		{"trunc", 600 * time.Millisecond, false},
+		{"hours=1", time.Hour, true},
+		{"hours=1", -time.Hour, true},
+		{"hours=1", 2 * time.Hour, false},
+		{"hours=1", time.Hour + time.Second, false},
+		{"hours=2,window=1s", 2*time.Hour - time.Second, true},
+		{"hours=2,window=1s,trunc", 2*time.Hour + 1600*time.Millisecond, false},
+		{"hours=2,window=1s,trunc", 2*time.Hour + 1400*time.Millisecond, true},
+	}
+	for _, tc := range tests {
+		var tol TimeTolerance
+		require.NoError(t, tol.Set(tc.tol))
+		assert.Equal(t, tc.want, tol.Equal(t0.Add(tc.d), t0), "%q %v", tc.tol, tc.d)
+		assert.Equal(t, tc.want, tol.Equal(t0, t0.Add(tc.d)), "%q %v", tc.tol, -tc.d)
+	}
+
+	var tol TimeTolerance
+	require.NoError(t, tol.Set("window=2s, hours=1,trunc"))
+	require.Equal(t, TimeTolerance{2 * time.Second, 1, true}, tol)
+	require.Equal(t, "window=2s,hours=1,trunc", tol.String())
+	require.NoError(t, tol.Set(""))
+	require.True(t, tol.IsExact())
+	for _, s := range []string{"window", "window=-1s", "hours=25", "trunc=1", "x"} {
+		require.Error(t, tol.Set(s), "%s", s)
+	}
+}
+
+func TestScanTimeTolerance(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a": {Data: []byte("a"), ModTime: t0},
+		"b": {Data: []byte("b"), ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+
+	// Simulate a copy to FAT and a DST shift
+	fsys["a"].ModTime = t0.Add(time.Second)
+	fsys["b"].ModTime = t0.Add(time.Hour)
+	s := Scanner{MTime: TimeTolerance{Window: 2 * time.Second}}
+	have, err := s.Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	require.Equal(t, s.MTime, have.MTime())
+	assert.Equal(t, flagSame, have.ToTree().File("a").flag)
+	assert.Equal(t, t0.Add(time.Second), have.ToTree().File("a").modTime)
+	assert.Equal(t, flagNone, have.ToTree().File("b").flag)
+
+	// Tree status uses the tolerance recorded in the index
+	fsys["a"].ModTime = t0
+	all, err := have.ToTree().Status(context.Background(), fsys, nil)
+	require.NoError(t, err)
+	require.Empty(t, all)
+}
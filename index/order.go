@@ -0,0 +1,73 @@
+package index
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Order specifies the order in which files are hashed.
+type Order byte
+
+const (
+	WalkOrder   Order = iota // Directory walk order
+	InodeOrder               // Inode number order
+	ExtentOrder              // Physical location of the first extent (Linux)
+)
+
+// String returns the name of the order.
+func (o Order) String() string {
+	switch o {
+	case WalkOrder:
+		return "walk"
+	case InodeOrder:
+		return "inode"
+	case ExtentOrder:
+		return "extent"
+	}
+	return fmt.Sprintf("Order(%d)", o)
+}
+
+// Set implements flag.Value by setting the order with the specified name.
+func (o *Order) Set(name string) error {
+	for v := WalkOrder; v <= ExtentOrder; v++ {
+		if v.String() == name {
+			*o = v
+			return nil
+		}
+	}
+	return fmt.Errorf("index: invalid order: %s", name)
+}
+
+// sortByDisk sorts file names by their physical location on disk to minimize
+// seek time on rotational media. Files with an unknown location are moved to
+// the end, preserving their walk order. If the order is not supported by the
+// file system, a Notice is reported once and names are returned unmodified.
+func (w *walker) sortByDisk(cp ctxPoller, names []string) []string {
+	type entry struct {
+		key  uint64
+		name string
+	}
+	all := make([]entry, 0, len(names))
+	for _, name := range names {
+		if cp.canceled() {
+			return nil
+		}
+		key, err := diskKey(w.fsys, name, w.Order)
+		if err != nil {
+			if errors.Is(err, errors.ErrUnsupported) {
+				w.err(&Notice{fmt.Errorf("index: %v order not supported, using walk order (%w)", w.Order, err)})
+				return names
+			}
+			key = math.MaxUint64
+		}
+		all = append(all, entry{key, name})
+	}
+	slices.SortStableFunc(all, func(a, b entry) int { return cmp.Compare(a.key, b.key) })
+	for i := range all {
+		names[i] = all[i].name
+	}
+	return names
+}
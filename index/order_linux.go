@@ -0,0 +1,84 @@
+package index
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskKey returns the sort key of the specified file for the given order.
+func diskKey(fsys fs.FS, name string, order Order) (uint64, error) {
+	switch order {
+	case InodeOrder:
+		fi, err := fs.Stat(fsys, name)
+		if err != nil {
+			return 0, err
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			return st.Ino, nil
+		}
+	case ExtentOrder:
+		f, err := fsys.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = f.Close() }()
+		if f, ok := f.(*os.File); ok {
+			return firstExtent(f)
+		}
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// FIEMAP ioctl definitions from linux/fiemap.h.
+const fsIocFiemap = 0xC020660B // _IOWR('f', 11, struct fiemap)
+
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	_             uint32
+	extent        [1]fiemapExtent
+}
+
+type fiemapExtent struct {
+	logical  uint64
+	physical uint64
+	length   uint64
+	_        [2]uint64
+	flags    uint32
+	_        [3]uint32
+}
+
+// firstExtent returns the physical byte offset of the first extent of f. Files
+// without any extents (e.g. empty or inline files) return 0.
+func firstExtent(f *os.File) (uint64, error) {
+	fm := fiemap{length: math.MaxUint64, extentCount: 1}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	err2 := rc.Control(func(fd uintptr) {
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, fsIocFiemap, uintptr(unsafe.Pointer(&fm)))
+		if errno != 0 {
+			err = errno
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err2 != nil {
+		return 0, err2
+	}
+	if fm.mappedExtents == 0 {
+		return 0, nil
+	}
+	return fm.extent[0].physical, nil
+}
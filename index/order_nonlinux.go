@@ -0,0 +1,13 @@
+//go:build !linux
+
+package index
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// diskKey returns the sort key of the specified file for the given order.
+func diskKey(fs.FS, string, Order) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
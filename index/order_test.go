@@ -0,0 +1,100 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder(t *testing.T) {
+	var o Order
+	for _, want := range []Order{InodeOrder, ExtentOrder, WalkOrder} {
+		require.NoError(t, o.Set(want.String()))
+		require.Equal(t, want, o)
+	}
+	require.Error(t, o.Set("random"))
+	require.Equal(t, WalkOrder, o)
+}
+
+func TestScanOrder(t *testing.T) {
+	root := t.TempDir()
+	testTree(t, root, 32, 1)
+	fsys := os.DirFS(root)
+	want, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	for _, order := range []Order{InodeOrder, ExtentOrder} {
+		var errs []error
+		s := Scanner{ErrFn: func(err error) { errs = append(errs, err) }, Order: order}
+		have, err := s.Scan(context.Background(), fsys)
+		require.NoError(t, err)
+		require.Equal(t, want.groups, have.groups, "%v", order)
+		require.LessOrEqual(t, len(errs), 1, "%v", order) // Unsupported order
+	}
+
+	// fstest.MapFS does not support on-disk ordering
+	var errs []error
+	s := Scanner{ErrFn: func(err error) { errs = append(errs, err) }, Order: InodeOrder}
+	_, err = s.Scan(context.Background(), fstest.MapFS{"a": {}, "b": {}})
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	var n *Notice
+	assert.True(t, errors.As(errs[0], &n))
+	assert.ErrorIs(t, errs[0], errors.ErrUnsupported)
+}
+
+// BenchmarkScanOrder compares hashing throughput for each Order on a synthetic
+// tree whose files are created in random order, so that walk order differs
+// from on-disk order. The effect is only visible with a cold page cache on
+// rotational media. Set FSX_BENCH_DIR to a directory on such a disk and drop
+// the page cache (e.g. "echo 3 >/proc/sys/vm/drop_caches") before each run.
+func BenchmarkScanOrder(b *testing.B) {
+	root := os.Getenv("FSX_BENCH_DIR")
+	if root == "" {
+		root = b.TempDir()
+	} else {
+		root = filepath.Join(root, "fsx-bench")
+	}
+	if _, err := os.Stat(filepath.Join(root, "0")); err != nil {
+		testTree(b, root, 1024, 64*1024)
+	}
+	fsys := os.DirFS(root)
+	for _, order := range []Order{WalkOrder, InodeOrder, ExtentOrder} {
+		b.Run(order.String(), func(b *testing.B) {
+			s := Scanner{ErrFn: func(err error) { b.Log(err) }, Order: order}
+			var size int64
+			for i := 0; i < b.N; i++ {
+				x, err := s.Scan(context.Background(), fsys)
+				require.NoError(b, err)
+				if size == 0 {
+					for _, f := range x.Files() {
+						size += f.size
+					}
+					b.SetBytes(size)
+				}
+			}
+		})
+	}
+}
+
+// testTree creates n files of the specified size under root. Files are spread
+// over 16 directories and created in random order.
+func testTree(tb testing.TB, root string, n, size int) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	for i := 0; i < 16; i++ {
+		require.NoError(tb, os.MkdirAll(filepath.Join(root, fmt.Sprint(i)), 0o755))
+	}
+	for _, i := range rnd.Perm(n) {
+		rnd.Read(data)
+		name := filepath.Join(root, fmt.Sprint(i%16), fmt.Sprint(i))
+		require.NoError(tb, os.WriteFile(name, data, 0o644))
+	}
+}
@@ -0,0 +1,207 @@
+package index
+
+import (
+	"io"
+	"math/bits"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"lukechampine.com/blake3/guts"
+)
+
+// Files of at least parallelMin bytes are split into parallelSeg segments that
+// are hashed concurrently. Each segment is a complete BLAKE3 subtree, so
+// parallelSeg must be a power-of-two multiple of the SIMD buffer size.
+const (
+	parallelMin = 64 * 1024 * 1024
+	parallelSeg = 4 * 1024 * 1024
+	simdBuf     = guts.MaxSIMD * guts.ChunkSize
+)
+
+// segBufs contains reusable segment buffers.
+var segBufs = sync.Pool{New: func() any { return new([parallelSeg]byte) }}
+
+// readParallel computes the digest of the first size bytes of r by hashing
+// segments concurrently. The number of concurrent segments is limited by the
+// capacity of h.par, which is shared by all hashers of one scan. It returns
+// the number of bytes read, which is less than size if r is truncated.
+func (h *Hasher) readParallel(r io.ReaderAt, size int64) (Digest, int64, error) {
+	cvs := make([][8]uint32, (size+parallelSeg-1)/parallelSeg)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var err error
+	total := size
+	for i := range cvs {
+		h.par <- struct{}{}
+		mu.Lock()
+		stop := err != nil || total < size
+		mu.Unlock()
+		if stop {
+			<-h.par
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-h.par
+				wg.Done()
+			}()
+			buf := segBufs.Get().(*[parallelSeg]byte)
+			defer segBufs.Put(buf)
+			off := int64(i) * parallelSeg
+			b := buf[:min(parallelSeg, size-off)]
+			n, rerr := r.ReadAt(b, off)
+			if n == len(b) {
+				rerr = nil
+			} else if rerr == io.EOF {
+				mu.Lock()
+				total = min(total, off+int64(n))
+				mu.Unlock()
+				return
+			}
+			if rerr == nil && h.m != nil {
+				rerr = h.m(n)
+			}
+			if rerr != nil {
+				mu.Lock()
+				if err == nil {
+					err = rerr
+				}
+				mu.Unlock()
+				return
+			}
+			cvs[i] = guts.ChainingValue(subtreeNode(b, uint64(off/guts.ChunkSize)))
+		}(i)
+	}
+	wg.Wait()
+	if err != nil || total < size {
+		return Digest{}, total, err
+	}
+	root := rootNode(cvs)
+	root.Flags |= guts.FlagRoot
+	out := guts.WordsToBytes(guts.CompressNode(root))
+	return Digest(out[:len(Digest{})]), size, nil
+}
+
+// subtreeNode returns the root node of the BLAKE3 subtree for b, which starts
+// at the specified chunk counter.
+func subtreeNode(b []byte, counter uint64) guts.Node {
+	if len(b) <= simdBuf {
+		var buf *[simdBuf]byte
+		if len(b) == simdBuf {
+			buf = (*[simdBuf]byte)(b)
+		} else {
+			buf = new([simdBuf]byte)
+			copy(buf[:], b)
+		}
+		return guts.CompressBuffer(buf, len(b), &guts.IV, counter, 0)
+	}
+	left := leftChunks((len(b) + guts.ChunkSize - 1) / guts.ChunkSize)
+	n := left * guts.ChunkSize
+	return guts.ParentNode(
+		guts.ChainingValue(subtreeNode(b[:n], counter)),
+		guts.ChainingValue(subtreeNode(b[n:], counter+uint64(left))),
+		&guts.IV, 0)
+}
+
+// rootNode returns the root node of the tree with the specified subtree
+// chaining values. There must be at least two subtrees.
+func rootNode(cvs [][8]uint32) guts.Node {
+	left := leftChunks(len(cvs))
+	return guts.ParentNode(mergeCVs(cvs[:left]), mergeCVs(cvs[left:]), &guts.IV, 0)
+}
+
+// mergeCVs returns the chaining value of the tree with the specified subtree
+// chaining values.
+func mergeCVs(cvs [][8]uint32) [8]uint32 {
+	if len(cvs) == 1 {
+		return cvs[0]
+	}
+	return guts.ChainingValue(rootNode(cvs))
+}
+
+// leftChunks returns the number of chunks in the left subtree of a BLAKE3 tree
+// with n > 1 chunks, which is the largest power of two less than n.
+func leftChunks(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// zeroDigests returns the BLAKE3 digests of all-zero files with the specified
+// sizes, which must be positive and in ascending order. Segments are hashed
+// concurrently, and the digests of all sizes that end in the same segment are
+// computed incrementally from its chunk chaining values, so the total work is
+// proportional to the largest size. It returns nil if cp is canceled.
+func zeroDigests(cp ctxPoller, sizes []int64) []Digest {
+	if len(sizes) == 0 {
+		return nil
+	}
+	zeros := make([]byte, parallelSeg)
+	nseg := int((sizes[len(sizes)-1] + parallelSeg - 1) / parallelSeg)
+	cvs := make([][8]uint32, nseg) // Chaining values of full segments
+	part := make([]guts.Node, len(sizes))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for n := min(runtime.NumCPU(), nseg); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < nseg && !cp.canceled(); i = int(next.Add(1) - 1) {
+				off := int64(i) * parallelSeg
+				counter := uint64(off / guts.ChunkSize)
+				if i < nseg-1 {
+					cvs[i] = guts.ChainingValue(subtreeNode(zeros, counter))
+				}
+				lo, _ := slices.BinarySearch(sizes, off+1)
+				hi, _ := slices.BinarySearch(sizes, off+parallelSeg+1)
+				rel := make([]int64, hi-lo)
+				for j := range rel {
+					rel[j] = sizes[lo+j] - off
+				}
+				copy(part[lo:hi], zeroPrefixes(zeros, counter, rel))
+			}
+		}()
+	}
+	wg.Wait()
+	if cp.canceled() {
+		return nil
+	}
+	all := make([]Digest, len(sizes))
+	for j, size := range sizes {
+		root := part[j]
+		if i := int((size - 1) / parallelSeg); i > 0 {
+			root = rootNode(append(cvs[:i:i], guts.ChainingValue(root)))
+		}
+		root.Flags |= guts.FlagRoot
+		out := guts.WordsToBytes(guts.CompressNode(root))
+		all[j] = Digest(out[:len(Digest{})])
+	}
+	return all
+}
+
+// zeroPrefixes returns the root nodes of the BLAKE3 subtrees for the first
+// rel[j] bytes of zeros, which start at the specified chunk counter. Offsets
+// must be positive and in ascending order. Each chunk is compressed once, and
+// the chaining values of complete subtrees are kept on a stack, as in the
+// reference implementation.
+func zeroPrefixes(zeros []byte, counter uint64, rel []int64) []guts.Node {
+	all := make([]guts.Node, len(rel))
+	var stack [][8]uint32
+	for c, j := int64(0), 0; j < len(rel); c++ {
+		off := c * guts.ChunkSize
+		for ; j < len(rel) && rel[j] <= off+guts.ChunkSize; j++ {
+			n := guts.CompressChunk(zeros[:rel[j]-off], &guts.IV, counter+uint64(c), 0)
+			for k := len(stack) - 1; k >= 0; k-- {
+				n = guts.ParentNode(stack[k], guts.ChainingValue(n), &guts.IV, 0)
+			}
+			all[j] = n
+		}
+		stack = append(stack, guts.ChainingValue(guts.CompressChunk(zeros[:guts.ChunkSize], &guts.IV, counter+uint64(c), 0)))
+		for t := c + 1; t&1 == 0; t >>= 1 {
+			n := guts.ParentNode(stack[len(stack)-2], stack[len(stack)-1], &guts.IV, 0)
+			stack = append(stack[:len(stack)-2], guts.ChainingValue(n))
+		}
+	}
+	return all
+}
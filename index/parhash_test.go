@@ -0,0 +1,57 @@
+package index
+
+import (
+	"bytes"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/blake3"
+)
+
+func TestReadParallel(t *testing.T) {
+	b := make([]byte, 5*parallelSeg)
+	rand.New(rand.NewSource(1)).Read(b)
+	h := NewHasher(nil)
+	h.par = make(chan struct{}, runtime.NumCPU())
+	for _, n := range []int{
+		parallelSeg + 1,
+		2 * parallelSeg,
+		3*parallelSeg + 1000,
+		4*parallelSeg + simdBuf,
+		5*parallelSeg - 1,
+	} {
+		d, k, err := h.readParallel(bytes.NewReader(b[:n]), int64(n))
+		require.NoError(t, err)
+		assert.Equal(t, int64(n), k)
+		assert.Equal(t, Digest(blake3.Sum256(b[:n])), d, "%d", n)
+	}
+
+	// Truncated file
+	_, k, err := h.readParallel(bytes.NewReader(b[:2*parallelSeg+5]), 3*parallelSeg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*parallelSeg+5), k)
+}
+
+func TestZeroDigests(t *testing.T) {
+	sizes := []int64{
+		1, 1023, 1024, 1025, 3 * 1024, simdBuf + 1,
+		parallelSeg - 1, parallelSeg, parallelSeg + 1,
+		2*parallelSeg + 5000, 3 * parallelSeg,
+	}
+	zeros := make([]byte, sizes[len(sizes)-1])
+	all := zeroDigests(ctxPoller(nil), sizes)
+	require.Len(t, all, len(sizes))
+	for i, n := range sizes {
+		assert.Equal(t, Digest(blake3.Sum256(zeros[:n])), all[i], "%d", n)
+	}
+	assert.Nil(t, zeroDigests(ctxPoller(nil), nil))
+}
+
+func TestLeftChunks(t *testing.T) {
+	for n, want := range map[int]int{2: 1, 3: 2, 4: 2, 5: 4, 8: 4, 9: 8, 1025: 1024} {
+		assert.Equal(t, want, leftChunks(n), "%d", n)
+	}
+}
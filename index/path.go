@@ -65,6 +65,14 @@ func (p path) contains(other path) bool {
 		other[:len(p)] == p && p[len(p)-1] == '/')
 }
 
+// fsName returns p in the format expected by fs.FS, without the trailing '/'.
+func (p path) fsName() string {
+	if p.isDir() && p != "." {
+		return string(p[:len(p)-1])
+	}
+	return string(p)
+}
+
 // dir returns the parent directory of p. It panics if p is empty.
 func (p path) dir() path {
 	if p == "" {
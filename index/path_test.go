@@ -48,6 +48,13 @@ func TestPathContains(t *testing.T) {
 	assert.True(t, path("a/").contains("a/b"))
 }
 
+func TestPathFSName(t *testing.T) {
+	assert.Equal(t, ".", path(".").fsName())
+	assert.Equal(t, "a", path("a").fsName())
+	assert.Equal(t, "a", path("a/").fsName())
+	assert.Equal(t, "a/b", path("a/b/").fsName())
+}
+
 func TestPathDirBase(t *testing.T) {
 	tests := []struct {
 		p, dir path
@@ -2,12 +2,15 @@ package index
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,169 +23,665 @@ import (
 // file-specific errors. If progFn is non-nil, it is called at regular intervals
 // to report progress. A non-nil error is returned if ctx is canceled.
 func Scan(ctx context.Context, fsys fs.FS, errFn func(error), progFn func(*Progress)) (*Index, error) {
-	return (*Tree)(nil).Rescan(ctx, fsys, errFn, progFn)
+	return (&Scanner{ErrFn: errFn, ProgFn: progFn}).Scan(ctx, fsys)
 }
 
 // Rescan updates the index of fsys, skipping the hashing of any files that have
 // identical names, sizes, and modification times. See Scan for more info. Tree
 // t should not be accessed after this operation.
 func (t *Tree) Rescan(ctx context.Context, fsys fs.FS, errFn func(error), progFn func(*Progress)) (*Index, error) {
+	return (&Scanner{ErrFn: errFn, ProgFn: progFn}).Rescan(ctx, t, fsys)
+}
+
+// Scanner configures file system scanning. The zero value is a valid scanner
+// that hashes files in directory walk order without reporting errors or
+// progress.
+type Scanner struct {
+	ErrFn    func(error)     // Called for any file-specific errors
+	ProgFn   func(*Progress) // Called at regular intervals to report progress
+	Order    Order           // Order in which files are hashed
+	Rate     uint64          // Maximum total hashing throughput in bytes/sec
+	NoCache  bool            // Evict file data from the page cache after hashing
+	Precount bool            // Count all files before hashing to estimate ETA
+	Moves    bool            // Detect moved files by size and modification time
+	MTime    TimeTolerance   // Modification time tolerance for unchanged files
+	Hash     Algorithm       // Hash algorithm, which must match that of the tree
+
+	// Secondary lists additional algorithms, such as MD5 or SHA-1, that are
+	// computed in the same pass as the primary digest. Unchanged files that do
+	// not have all secondary digests are hashed again.
+	Secondary []Algorithm
+
+	// ChunkSize, if non-zero, splits files into content-defined chunks with
+	// the specified average size, which must be a power of two between
+	// MinChunkSize and MaxChunkSize. Chunk digests are used to find files with
+	// similar contents. Unchanged files without chunks are hashed again.
+	ChunkSize int
+
+	// MoveCheck, if Moves is set, also compares the first and last chunks of
+	// each moved file with those recorded for the original file before reusing
+	// its digest. Moved files without recorded chunks are hashed again.
+	MoveCheck bool
+
+	// XattrCache enables the use of digests cached in extended attributes to
+	// avoid reading files that were already hashed, possibly by another index.
+	// New digests are added to the cache. Only supported on Linux.
+	XattrCache bool
+
+	// Lazy skips reading files that cannot have copies. Files with unique sizes
+	// are not read at all, and same-size files are first compared by hashing
+	// only their first and last 64 KiB. Only the files that still match are
+	// fully hashed. All other files are recorded with partial digests, which
+	// are fully computed by the next scan that is not lazy.
+	Lazy bool
+
+	// Subtree, if non-empty, limits Rescan to the specified directory. Files
+	// outside of it are copied from the original tree without any changes.
+	Subtree string
+
+	// Retries is the number of times that a file modified while being hashed
+	// is read again before it is recorded as volatile. RetryDelay is the
+	// initial delay between attempts, which doubles after each retry.
+	Retries    int
+	RetryDelay time.Duration
+
+	// CheckpointFn, if non-nil, is called with a partial index at
+	// CheckpointRate intervals and once more if the scan is canceled. The
+	// partial index can be used as the base tree to resume the scan.
+	CheckpointFn   func(*Index)
+	CheckpointRate time.Duration
+}
+
+// Scan creates an index of fsys. A non-nil error is returned if ctx is
+// canceled.
+func (s *Scanner) Scan(ctx context.Context, fsys fs.FS) (*Index, error) {
+	return s.Rescan(ctx, nil, fsys)
+}
+
+// Rescan updates index t of fsys, skipping the hashing of any files that have
+// identical names, sizes, and modification times. If t is nil, this is
+// equivalent to Scan. Tree t should not be accessed after this operation.
+func (s *Scanner) Rescan(ctx context.Context, t *Tree, fsys fs.FS) (*Index, error) {
+	sub, err := s.subtree(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Hash.IsPrimary() {
+		return nil, fmt.Errorf("index: not a primary hash algorithm: %v", s.Hash)
+	}
+	if err := validSecondary(s.Hash, s.Secondary); err != nil {
+		return nil, err
+	}
+	if err := validChunkSize(s.ChunkSize); err != nil {
+		return nil, err
+	}
+	if t != nil && t.hash != s.Hash {
+		return nil, fmt.Errorf("index: hash algorithm mismatch (index uses %v, scanner uses %v)", t.hash, s.Hash)
+	}
+	if s.XattrCache && (!xattrSupported || s.Hash != BLAKE3) {
+		return nil, fmt.Errorf("index: digest cache: %w", errors.ErrUnsupported)
+	}
+
 	// Clear non-persistent flags
 	if t != nil {
 		for _, g := range t.idx {
 			for _, f := range g {
-				f.flag &= flagPersist
+				f.flag &= flagPersist | flagPartial
 			}
 		}
 	}
 
-	// Setup progress tracking
+	// Setup progress tracking. The totals from t are used as an estimate until
+	// the optional pre-walk is finished.
+	cp := ctxPoller(ctx.Done())
 	var prog *Progress
 	var progTick <-chan time.Time
-	if progFn != nil {
+	var total chan [2]uint64
+	if s.ProgFn != nil {
 		prog = newProgress(time.Now())
+		if t != nil {
+			prog.totalFiles, prog.totalBytes = t.totals(sub)
+		}
+		if s.Precount {
+			ctx, stop := context.WithCancel(ctx)
+			defer stop()
+			total = make(chan [2]uint64, 1)
+			go func() {
+				files, bytes := count(ctxPoller(ctx.Done()), fsys, sub)
+				total <- [2]uint64{files, bytes}
+			}()
+		}
 		t := time.NewTicker(time.Second)
 		defer t.Stop()
 		progTick = t.C
 	}
 
+	// Setup checkpoints. Files in t that have not been visited yet are copied
+	// to the partial index as they were before the scan.
+	root := dirFSRoot(fsys)
+	var base Files
+	var ckptTick <-chan time.Time
+	if s.CheckpointFn != nil {
+		if t != nil {
+			base = t.snapshot()
+		}
+		if s.CheckpointRate > 0 {
+			t := time.NewTicker(s.CheckpointRate)
+			defer t.Stop()
+			ckptTick = t.C
+		}
+	}
+
 	// Start walker and hasher goroutines
 	file := make(chan *File, 1)
-	var werr chan error
-	if errFn != nil {
-		werr = make(chan error, 1)
+	werr := make(chan error, 1)
+	w := &walker{Scanner: s, fsys: fsys, sub: sub, file: file, werr: werr}
+	if prog != nil {
+		w.active = make([]atomic.Pointer[string], runtime.NumCPU())
 	}
-	cp := ctxPoller(ctx.Done())
-	go (&walker{fsys: fsys, file: file, werr: werr}).walk(cp, t, func(n int) error {
-		if prog != nil {
-			prog.sampleBytes.Add(uint64(n))
-		}
-		if !cp.canceled() {
-			return nil
-		}
-		return context.Canceled
-	})
+	go w.walk(cp, t, s.monitor(cp, prog))
 
-	// Receive files from walk and hash goroutines
+	// Receive files and errors from walk and hash goroutines
 	all := make(Files, 0, 64)
+	var errs []*FileError
 recv:
 	for {
 		select {
 		case f, ok := <-file:
 			if !ok {
+				// Final errors may still be buffered after file is closed
+				for len(werr) > 0 {
+					errs = s.fileErr(errs, <-werr)
+				}
 				break recv
 			}
 			if all = append(all, f); prog != nil {
-				prog.sampleFiles++
+				if f.flag&flagSame != 0 {
+					prog.reusedFiles++
+					prog.reusedBytes += uint64(f.size)
+				} else {
+					prog.sampleFiles++
+				}
 			}
+		case n := <-total:
+			prog.totalFiles, prog.totalBytes = n[0], n[1]
 		case err := <-werr:
-			errFn(err)
+			errs = s.fileErr(errs, err)
 		case now := <-progTick:
 			prog.update(now)
-			progFn(prog)
+			prog.active = w.activeNames(prog.active)
+			s.ProgFn(prog)
+		case <-ckptTick:
+			s.CheckpointFn(w.checkpoint(root, all, base, errs, t))
 		}
 	}
-	if prog != nil {
-		prog.final = true
-		prog.update(time.Now())
-		progFn(prog)
-	}
 	if cp.canceled() {
+		s.finalProgress(prog)
+		if s.CheckpointFn != nil {
+			s.CheckpointFn(w.checkpoint(root, all, base, errs, t))
+		}
 		return nil, ctx.Err()
 	}
 
 	// all describes current contents of fsys. Files marked flagSame are shared
 	// with t. All other files in t have been either removed or modified, so we
 	// mark them with flagGone. Those that have any flagKeep flags are copied
-	// over to preserve prior decisions.
+	// over to preserve prior decisions. Files outside of the subtree were not
+	// visited and are copied as they are.
 	if t != nil {
+		for _, e := range t.errs {
+			if !sub.contains(path(e.Path)) {
+				errs = append(errs, e)
+			}
+		}
 		for _, g := range t.idx {
 			for _, f := range g {
 				if f.flag&flagSame != 0 {
 					continue // Already in all
 				}
+				if !sub.contains(f.path) {
+					all = append(all, f)
+					continue
+				}
 				if f.flag |= flagGone; f.flag&flagKeep != 0 {
 					all = append(all, f)
 				}
 			}
 		}
 	}
+
+	// Hash files with partial digests that may have copies. If this is
+	// interrupted, the index is still valid and is saved as a checkpoint.
+	if s.Lazy {
+		var tick func()
+		if prog != nil {
+			tick = func() {
+				prog.update(time.Now())
+				s.ProgFn(prog)
+			}
+		}
+		w.resolve(cp, all, s.monitor(cp, prog), tick, func(err error) {
+			errs = s.fileErr(errs, err)
+		})
+	}
+	s.finalProgress(prog)
+	if t != nil {
+		for p, a := range t.alloc {
+			if !sub.contains(p) {
+				w.record(p, math.MaxInt64, a)
+			}
+		}
+	}
 	all.Sort()
-	return New(dirFSRoot(fsys), all), nil
+	x := New(root, all)
+	x.hash, x.mtime, x.alloc = s.Hash, s.MTime, w.alloc
+	x.secondary, x.chunkSize = s.Secondary, s.ChunkSize
+	x.setErrs(errs)
+	w.setSums(x, t)
+	w.setChunks(x, t)
+	if cp.canceled() {
+		if s.CheckpointFn != nil {
+			s.CheckpointFn(x)
+		}
+		return nil, ctx.Err()
+	}
+	return x, nil
+}
+
+// finalProgress sends the final progress report if prog is non-nil.
+func (s *Scanner) finalProgress(prog *Progress) {
+	if prog != nil {
+		prog.final = true
+		prog.update(time.Now())
+		prog.active = prog.active[:0]
+		s.ProgFn(prog)
+	}
+}
+
+// checkpoint returns a partial index with the secondary digests and chunks of
+// all files hashed so far and those from the base tree t, which may be nil.
+// Errors and allocated sizes are taken from errs and the walker for the files
+// that were visited, and from t for those outside of the subtree, which are
+// not visited again when the scan is resumed.
+func (w *walker) checkpoint(root string, all, base Files, errs []*FileError, t *Tree) *Index {
+	x := w.partialIndex(root, all, base)
+	errs = slices.Clone(errs)
+	w.mu.Lock()
+	alloc := maps.Clone(w.alloc)
+	w.mu.Unlock()
+	if t != nil {
+		for _, e := range t.errs {
+			if !w.sub.contains(path(e.Path)) {
+				errs = append(errs, e)
+			}
+		}
+		for p, a := range t.alloc {
+			if !w.sub.contains(p) {
+				if alloc == nil {
+					alloc = make(map[path]int64)
+				}
+				alloc[p] = a
+			}
+		}
+	}
+	x.setErrs(errs)
+	x.alloc = alloc
+	w.setSums(x, t)
+	w.setChunks(x, t)
+	return x
+}
+
+// partialIndex returns an index of all files received so far. Files in base
+// are included unless they exist and were already received.
+func (s *Scanner) partialIndex(root string, all, base Files) *Index {
+	seen := make(map[path]struct{}, len(all))
+	for _, f := range all {
+		seen[f.path] = struct{}{}
+	}
+	part := append(make(Files, 0, len(all)+len(base)), all...)
+	for _, f := range base {
+		if _, ok := seen[f.path]; !ok || f.flag.IsGone() {
+			part = append(part, f)
+		}
+	}
+	part.Sort()
+	x := New(root, part)
+	x.hash, x.mtime, x.secondary, x.chunkSize = s.Hash, s.MTime, s.Secondary, s.ChunkSize
+	return x
+}
+
+// fileErr reports err to ErrFn and appends it to errs if it should be recorded
+// in the index.
+func (s *Scanner) fileErr(errs []*FileError, err error) []*FileError {
+	if fe := (*FileError)(nil); errors.As(err, &fe) {
+		if e := fe.entry(); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	if s.ErrFn != nil {
+		s.ErrFn(err)
+	}
+	return errs
+}
+
+// monitor returns the Hasher monitor function that updates prog, enforces the
+// rate limit, and aborts hashing when cp is canceled.
+func (s *Scanner) monitor(cp ctxPoller, prog *Progress) func(int) error {
+	var lim *limiter
+	if s.Rate > 0 {
+		lim = &limiter{rate: float64(s.Rate)}
+	}
+	return func(n int) error {
+		if prog != nil {
+			prog.sampleBytes.Add(uint64(n))
+		}
+		if lim != nil {
+			lim.wait(cp, n)
+		}
+		if !cp.canceled() {
+			return nil
+		}
+		return context.Canceled
+	}
+}
+
+// subtree returns the directory path of the subtree being scanned.
+func (s *Scanner) subtree(fsys fs.FS) (path, error) {
+	if s.Subtree == "" {
+		return ".", nil
+	}
+	c := cleanPath(s.Subtree)
+	if c == "" {
+		return "", fmt.Errorf("index: invalid subtree: %q", s.Subtree)
+	}
+	sub := dirPath(c)
+	if sub != "." {
+		fi, err := fs.Stat(fsys, sub.fsName())
+		if err != nil {
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", fmt.Errorf("index: subtree is not a directory: %s", sub)
+		}
+	}
+	return sub, nil
+}
+
+// count returns the total number and size of all regular files in the sub
+// directory of fsys.
+func count(cp ctxPoller, fsys fs.FS, sub path) (files, bytes uint64) {
+	_ = fs.WalkDir(fsys, sub.fsName(), func(_ string, e fs.DirEntry, err error) error {
+		if cp.canceled() {
+			return fs.SkipAll
+		}
+		if err == nil && e.Type().IsRegular() {
+			if fi, err := e.Info(); err == nil {
+				files++
+				bytes += uint64(fi.Size())
+			}
+		}
+		return nil
+	})
+	return
 }
 
 // walker walks the file system, hashing all regular files.
 type walker struct {
-	fsys fs.FS
-	file chan<- *File
-	werr chan<- error
-	wg   sync.WaitGroup
+	*Scanner
+	fsys   fs.FS
+	sub    path // Directory being walked
+	file   chan<- *File
+	werr   chan<- error
+	wg     sync.WaitGroup
+	active []atomic.Pointer[string] // Files being hashed by each worker
+
+	mu     sync.Mutex
+	alloc  map[path]int64     // Allocated sizes of sparse files
+	sums   map[Digest]Sums    // Secondary digests of hashed files
+	chunks map[Digest][]Chunk // Chunks of hashed files
 }
 
 func (w *walker) walk(cp ctxPoller, t *Tree, mon func(int) error) {
-	hash := make(chan string, 1)
+	hash := w.start(cp, mon)
 	defer func() {
 		close(hash)
 		w.wg.Wait()
 		close(w.file)
 	}()
-	for n := runtime.NumCPU(); n > 0; n-- {
-		w.wg.Add(1)
-		go w.hash(hash, mon)
+	var queue []string
+	var mv moves
+	var check func(name string, f *File) bool
+	if t != nil && w.Moves {
+		mv = newMoves(t, w.sub, w.Scanner)
+		if w.MoveCheck {
+			h := t.hash.NewHasher(mon)
+			check = func(name string, f *File) bool {
+				return h.checkMove(w.fsys, name, fileChunks(f, t.chunks, t.csize))
+			}
+		}
 	}
-	err := fs.WalkDir(w.fsys, ".", func(name string, e fs.DirEntry, err error) error {
+	err := fs.WalkDir(w.fsys, w.sub.fsName(), func(name string, e fs.DirEntry, err error) error {
 		if cp.canceled() {
 			return fs.SkipAll
 		}
-		if err != nil {
-			w.err(fmt.Errorf("index: walk error: %s (%w)", name, err))
+		// Names are validated first so that they can be written to the index
+		if !validName(name) {
+			w.err(fileError(PathErr, name, nil))
+			if e != nil && e.IsDir() {
+				return fs.SkipDir
+			}
 			return nil
 		}
-		if len(name) == 0 || name[0] == '\t' || strings.IndexByte(name, '\n') >= 0 {
-			w.err(fmt.Errorf("index: unsupported file path: %q", name))
-			return fs.SkipDir
+		if err != nil {
+			w.err(fileError(WalkErr, name, err))
+			return nil
 		}
 		if e.Type().IsRegular() {
 			if t != nil {
+				fi, err := e.Info()
 				// TODO: Does name need to go through filePath?
-				if f := t.file(path(name)); f != nil && f.isSame(e.Info()) {
+				if f := t.file(path(name)); f != nil && f.isSame(w.MTime, fi, err) &&
+					(w.Lazy || !f.flag.IsPartial() && t.reusable(f, w.Scanner)) {
 					f.flag = f.flag&^flagGone | flagSame
+					f.modTime = fi.ModTime()
+					w.sparse(f, fi)
 					w.file <- f
 					return nil
 				}
+				if mv != nil && err == nil {
+					if f := mv.find(w.fsys, w.MTime, name, fi, check); f != nil {
+						w.sparse(f, fi)
+						w.file <- f
+						return nil
+					}
+				}
+			}
+			if w.Order == WalkOrder {
+				hash <- name
+			} else {
+				queue = append(queue, name)
 			}
-			hash <- name
 		} else if !e.IsDir() {
-			w.err(fmt.Errorf("index: not a regular file or directory: %s", name))
+			w.err(fileError(TypeErr, name, nil))
 		}
 		return nil
 	})
 	if err != nil {
 		w.err(fmt.Errorf("index: walk error: %w", err))
 	}
+	if len(queue) > 0 && !cp.canceled() {
+		for _, name := range w.sortByDisk(cp, queue) {
+			if cp.canceled() {
+				break
+			}
+			hash <- name
+		}
+	}
+}
+
+// start starts hasher goroutines and returns the channel for sending them file
+// names. The channel must be closed once all names are sent. Large files are
+// split into segments that are hashed by up to one goroutine per CPU, shared by
+// all hashers, which keeps all CPUs busy when few large files remain.
+func (w *walker) start(cp ctxPoller, mon func(int) error) chan<- string {
+	hash := make(chan string, 1)
+	par := make(chan struct{}, runtime.NumCPU())
+	for i := runtime.NumCPU() - 1; i >= 0; i-- {
+		w.wg.Add(1)
+		go w.hash(i, cp, hash, mon, par)
+	}
+	return hash
 }
 
-func (w *walker) hash(names <-chan string, mon func(int) error) {
+func (w *walker) hash(i int, cp ctxPoller, names <-chan string, mon func(int) error, par chan struct{}) {
 	defer w.wg.Done()
-	h := NewHasher(mon)
+	h := w.newHasher(mon)
+	h.par = par
 	for name := range names {
-		if f, err := h.Read(w.fsys, name, true); err == nil {
+		if w.active != nil {
+			name := name
+			w.active[i].Store(&name)
+		}
+		var f *File
+		var err error
+		if w.Lazy {
+			f, err = h.stat(w.fsys, name)
+		} else {
+			f, err = w.read(cp, h, name)
+		}
+		if w.active != nil {
+			w.active[i].Store(nil)
+		}
+		if err == nil {
+			w.record(f.path, f.size, h.alloc)
+			w.addSums(f.digest, h.Sums())
+			w.addChunks(f, h.Chunks())
 			w.file <- f
-		} else if err != context.Canceled {
+		} else if !errors.Is(err, context.Canceled) {
 			w.err(err)
 		}
 	}
 }
 
+// newHasher returns a new Hasher configured by the Scanner options.
+func (s *Scanner) newHasher(mon func(int) error) *Hasher {
+	h := s.Hash.NewHasher(mon)
+	h.noCache, h.xattr = s.NoCache, s.XattrCache
+	h.setSums(s.Secondary)
+	h.setChunks(s.ChunkSize)
+	return h
+}
+
+// read hashes the specified file, retrying if it is modified while being read.
+func (w *walker) read(cp ctxPoller, h *Hasher, name string) (*File, error) {
+	delay := w.RetryDelay
+	for n := 0; ; n++ {
+		f, err := h.Read(w.fsys, name, true)
+		var fe *FileError
+		if n >= w.Retries || !errors.As(err, &fe) || fe.Kind != ModifiedErr {
+			return f, err
+		}
+		if !cp.sleep(delay) {
+			return nil, context.Canceled
+		}
+		delay *= 2
+	}
+}
+
+// activeNames appends the names of files being hashed by each worker to
+// names[:0]. Idle workers are represented by empty strings.
+func (w *walker) activeNames(names []string) []string {
+	names = names[:0]
+	for i := range w.active {
+		name := ""
+		if p := w.active[i].Load(); p != nil {
+			name = *p
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// sparse records the allocated size of file f if it has holes.
+func (w *walker) sparse(f *File, fi fs.FileInfo) {
+	if a, ok := sparseSize(w.fsys, string(f.path), fi); ok {
+		w.record(f.path, f.size, a)
+	}
+}
+
+// record records the allocated size of file p if it is a sparse file.
+func (w *walker) record(p path, size, alloc int64) {
+	if 0 <= alloc && alloc < size {
+		w.mu.Lock()
+		if w.alloc == nil {
+			w.alloc = make(map[path]int64)
+		}
+		w.alloc[p] = alloc
+		w.mu.Unlock()
+	}
+}
+
+// takeAlloc removes and returns the recorded allocated size of sparse file p.
+func (w *walker) takeAlloc(p path) (int64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	a, ok := w.alloc[p]
+	delete(w.alloc, p)
+	return a, ok
+}
+
 func (w *walker) err(err error) {
 	if w.werr != nil {
 		w.werr <- err
 	}
 }
 
+// limiter limits the total throughput of multiple hashers.
+type limiter struct {
+	mu   sync.Mutex
+	rate float64   // Bytes per second
+	next time.Time // Time when the previous read is paid for
+}
+
+// wait blocks until n bytes can be consumed without exceeding the rate limit
+// or until cp is canceled.
+func (l *limiter) wait(cp ctxPoller, n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-cp:
+		}
+	}
+}
+
 // ctxPoller simplifies polling context.Context for cancellation.
 type ctxPoller <-chan struct{}
 
+// sleep pauses for duration d. It returns false if p was canceled.
+func (p ctxPoller) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !p.canceled()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p:
+		return false
+	}
+}
+
 func (p ctxPoller) canceled() bool {
 	if p != nil {
 		select {
@@ -208,6 +707,12 @@ type Progress struct {
 	fps   float64
 	bps   float64
 	final bool
+
+	reusedFiles uint64 // Unmodified files that were not hashed
+	reusedBytes uint64
+	totalFiles  uint64 // Total (possibly estimated) number of files or 0
+	totalBytes  uint64
+	active      []string
 }
 
 // newProgress creates a new Progress with the specified start time.
@@ -221,31 +726,101 @@ func (p *Progress) Duration() time.Duration { return p.dur }
 // IsFinal returns whether this is the final progress report.
 func (p *Progress) IsFinal() bool { return p.final }
 
+// Hashed returns the number and total size of files that were hashed.
+func (p *Progress) Hashed() (files, bytes uint64) { return p.files, p.bytes }
+
+// Reused returns the number and total size of unmodified files whose digests
+// were reused from the previous index.
+func (p *Progress) Reused() (files, bytes uint64) { return p.reusedFiles, p.reusedBytes }
+
+// Total returns the expected number and total size of all files, including
+// reused ones. It returns zeros if the totals are unknown.
+func (p *Progress) Total() (files, bytes uint64) { return p.totalFiles, p.totalBytes }
+
+// Rate returns the current number of files and bytes hashed per second.
+func (p *Progress) Rate() (fps, bps float64) { return p.fps, p.bps }
+
+// Active returns the names of files being hashed by each worker. Idle workers
+// are represented by empty strings. The returned slice is only valid until the
+// next report.
+func (p *Progress) Active() []string { return p.active }
+
+// Percent returns the completion percentage in the range [0,100] or -1 if the
+// totals are unknown. Reused files are counted as complete.
+func (p *Progress) Percent() float64 {
+	if p.final {
+		return 100
+	}
+	var pct float64
+	if p.totalBytes > 0 {
+		pct = 100 * float64(p.bytes+p.reusedBytes) / float64(p.totalBytes)
+	} else if p.totalFiles > 0 {
+		pct = 100 * float64(p.files+p.reusedFiles) / float64(p.totalFiles)
+	} else {
+		return -1
+	}
+	return min(pct, 100)
+}
+
+// ETA returns the estimated time remaining, rounded to the nearest second, or
+// -1 if it is unknown.
+func (p *Progress) ETA() time.Duration {
+	if p.final {
+		return 0
+	}
+	done := p.bytes + p.reusedBytes
+	if p.totalBytes == 0 || p.bps < 1 {
+		return -1
+	}
+	if done >= p.totalBytes {
+		return 0
+	}
+	sec := float64(p.totalBytes-done) / p.bps
+	return time.Duration(sec * float64(time.Second)).Round(time.Second)
+}
+
 func (p *Progress) String() string {
+	var b strings.Builder
 	files := humanize.Comma(int64(p.files))
 	bytes := humanize.IBytes(p.bytes)
+	fmt.Fprintf(&b, "Indexed %s files (%s)", files, bytes)
+	if p.reusedFiles > 0 {
+		files = humanize.Comma(int64(p.reusedFiles))
+		bytes = humanize.IBytes(p.reusedBytes)
+		fmt.Fprintf(&b, ", reused %s files (%s),", files, bytes)
+	}
 	bps := humanize.IBytes(uint64(math.Round(p.bps)))
-	return fmt.Sprintf("Indexed %s files (%s) in %v [%.0f files/sec, %s/sec]",
-		files, bytes, p.dur, p.fps, bps)
+	fmt.Fprintf(&b, " in %v [%.0f files/sec, %s/sec]", p.dur, p.fps, bps)
+	if pct := p.Percent(); pct >= 0 && !p.final {
+		fmt.Fprintf(&b, " %.1f%% done", pct)
+		if eta := p.ETA(); eta >= 0 {
+			fmt.Fprintf(&b, ", ETA %v", eta)
+		}
+	}
+	return b.String()
 }
 
 func (p *Progress) update(now time.Time) {
 	sampleBytes := p.sampleBytes.Swap(0)
 	sec := now.Sub(p.now).Seconds()
 	if sec < 0.5 {
-		p.sampleBytes.Add(sampleBytes)
-		return
-	}
-	alpha := min(sec/10, 1)
-	if p.start.Equal(p.now) {
-		alpha = 1 // First sample
+		// The final sample is recorded without updating the rates
+		if !p.final {
+			p.sampleBytes.Add(sampleBytes)
+			return
+		}
+	} else {
+		alpha := min(sec/10, 1)
+		if p.start.Equal(p.now) {
+			alpha = 1 // First sample
+		}
+		p.fps = (1-alpha)*p.fps + alpha*(float64(p.sampleFiles)/sec)
+		p.bps = (1-alpha)*p.bps + alpha*(float64(sampleBytes)/sec)
 	}
 	p.now = now
 	p.dur = now.Sub(p.start).Round(time.Second)
 	p.files += p.sampleFiles
 	p.bytes += sampleBytes
-	p.fps = (1-alpha)*p.fps + alpha*(float64(p.sampleFiles)/sec)
-	p.bps = (1-alpha)*p.bps + alpha*(float64(sampleBytes)/sec)
 	p.sampleFiles = 0
 }
 
@@ -1,10 +1,14 @@
 package index
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/fs"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -30,12 +34,12 @@ func TestScan(t *testing.T) {
 	require.NoError(t, err)
 	want := &Index{groups: []Files{
 		{
-			{"X/a", d1, 1, t1, flagNone},
-			{"Y/c", d1, 1, t2, flagNone},
+			{"X/a", d1, 1, t1, flagNone, nil},
+			{"Y/c", d1, 1, t2, flagNone, nil},
 		}, {
-			{"X/b", d2, 2, t2, flagNone},
+			{"X/b", d2, 2, t2, flagNone, nil},
 		}, {
-			{"d", d3, 3, t1, flagNone},
+			{"d", d3, 3, t1, flagNone, nil},
 		},
 	}}
 	require.Equal(t, want, x)
@@ -55,13 +59,13 @@ func TestScan(t *testing.T) {
 	require.NoError(t, err)
 	want = &Index{groups: []Files{
 		{
-			{"X/a", d1, 1, t1, flagJunk | flagGone},
-			{"e", d1, 1, t2, flagNone},
+			{"X/a", d1, 1, t1, flagJunk | flagGone, nil},
+			{"e", d1, 1, t2, flagNone, nil},
 		}, {
-			{"X/b", d3, 3, t2, flagNone},
-			{"d", d3, 3, t1, flagDup | flagSame},
+			{"X/b", d3, 3, t2, flagNone, nil},
+			{"d", d3, 3, t1, flagDup | flagSame, nil},
 		}, {
-			{"X/b", d2, 2, t2, flagKeep | flagGone},
+			{"X/b", d2, 2, t2, flagKeep | flagGone, nil},
 		},
 	}}
 	require.Equal(t, want, x)
@@ -77,14 +81,14 @@ func TestScan(t *testing.T) {
 	require.NoError(t, err)
 	want = &Index{groups: []Files{
 		{
-			{"X/a", d1, 1, t1, flagJunk | flagGone},
-			{"e", d1, 1, t2, flagDup | flagSame},
+			{"X/a", d1, 1, t1, flagJunk | flagGone, nil},
+			{"e", d1, 1, t2, flagDup | flagSame, nil},
 		}, {
-			{"X/b", d2, 2, t2, flagNone},
-			{"X/b", d2, 2, t2, flagKeep | flagGone},
+			{"X/b", d2, 2, t2, flagNone, nil},
+			{"X/b", d2, 2, t2, flagKeep | flagGone, nil},
 		}, {
-			{"d", d3, 3, t2, flagNone},
-			{"d", d3, 3, t1, flagDup | flagGone},
+			{"d", d3, 3, t2, flagNone, nil},
+			{"d", d3, 3, t1, flagDup | flagGone, nil},
 		},
 	}}
 	require.Equal(t, want, x)
@@ -144,6 +148,420 @@ func TestProgress(t *testing.T) {
 	p.update(t0.Add(2 * time.Second))
 	want = fmt.Sprintf("Indexed 2 files (1.1 KiB) in 2s [1 files/sec, %.0f B/sec]", 0.9*128+0.1*1024)
 	require.Equal(t, want, p.String())
+	require.Equal(t, -1.0, p.Percent())
+	require.Equal(t, time.Duration(-1), p.ETA())
+
+	p = newProgress(t0)
+	p.totalFiles, p.totalBytes = 4, 4096
+	p.reusedFiles, p.reusedBytes = 2, 1024
+	p.sampleFiles++
+	p.sampleBytes.Add(1024)
+	p.update(t0.Add(time.Second))
+	want = "Indexed 1 files (1.0 KiB), reused 2 files (1.0 KiB), in 1s [1 files/sec, 1.0 KiB/sec] 50.0% done, ETA 2s"
+	require.Equal(t, want, p.String())
+
+	p.final = true
+	require.Equal(t, 100.0, p.Percent())
+	require.Equal(t, time.Duration(0), p.ETA())
+}
+
+func TestScanPrecount(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":   {Data: []byte("a")},
+		"b/c": {Data: []byte("bc")},
+	}
+	var last *Progress
+	s := Scanner{ProgFn: func(p *Progress) { last = p }, Precount: true}
+	x, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	require.True(t, last.IsFinal())
+	files, bytes := last.Hashed()
+	require.Equal(t, [2]uint64{2, 3}, [2]uint64{files, bytes})
+
+	// Rescan uses previous totals even without a pre-walk
+	s.Precount = false
+	_, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	files, bytes = last.Reused()
+	require.Equal(t, [2]uint64{2, 3}, [2]uint64{files, bytes})
+	files, bytes = last.Total()
+	require.Equal(t, [2]uint64{2, 3}, [2]uint64{files, bytes})
+	files, _ = last.Hashed()
+	require.Zero(t, files)
+}
+
+func TestScanCheckpoint(t *testing.T) {
+	b1, d1 := testData("1")
+	b2, d2 := testData("2")
+	t0 := time.Now()
+	fsys := fstest.MapFS{
+		"a": {Data: b1, ModTime: t0},
+		"b": {Data: b2, ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	tr := x.ToTree()
+	tr.file("a").flag = flagKeep
+
+	// Canceled scan saves all files from the original tree
+	var part *Index
+	s := Scanner{CheckpointFn: func(x *Index) { part = x }}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Rescan(ctx, tr, fsys)
+	require.ErrorIs(t, err, context.Canceled)
+	want := &Index{groups: []Files{
+		{{"a", d1, 1, t0, flagKeep, nil}},
+		{{"b", d2, 1, t0, flagNone, nil}},
+	}}
+	require.Equal(t, want, part)
+
+	// Received files replace their originals
+	_, d3 := testData("3")
+	all := Files{{"b", d3, 1, t0, flagNone, nil}}
+	base := Files{
+		{"a", d1, 1, t0, flagKeep, nil},
+		{"b", d2, 1, t0, flagNone, nil},
+		{"b", d2, 1, t0, flagDup | flagGone, nil},
+	}
+	want = &Index{groups: []Files{
+		{{"a", d1, 1, t0, flagKeep, nil}},
+		{{"b", d3, 1, t0, flagNone, nil}},
+		{{"b", d2, 1, t0, flagDup | flagGone, nil}},
+	}}
+	require.Equal(t, want, (&Scanner{}).partialIndex("", all, base))
+
+	// Errors and allocated sizes outside of the subtree are preserved
+	fsys = fstest.MapFS{
+		"X/a": {Data: b1, ModTime: t0},
+		"c":   {Data: b2, ModTime: t0},
+	}
+	x, err = Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	tr = x.ToTree()
+	tr.errs = []*FileError{{ReadErr, "X/e", nil}, {ReadErr, "f", nil}}
+	tr.alloc = map[path]int64{"X/a": 0, "c": 0}
+	part = nil
+	s = Scanner{CheckpointFn: func(x *Index) { part = x }, Subtree: "X"}
+	_, err = s.Rescan(ctx, tr, fsys)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, part)
+	assert.Equal(t, []*FileError{{ReadErr, "f", nil}}, part.errs)
+	assert.Equal(t, map[path]int64{"c": 0}, part.alloc)
+}
+
+func TestScanSubtree(t *testing.T) {
+	b1, d1 := testData("\x00")
+	b2, _ := testData("\x00\x01")
+	b3, d3 := testData("\x00\x01\x02")
+	t0 := time.Now()
+	fsys := fstest.MapFS{
+		"X/a": {Data: b1, ModTime: t0},
+		"X/b": {Data: b2, ModTime: t0},
+		"Y/c": {Data: b1, ModTime: t0},
+		"d":   {Data: b3, ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+
+	// Change files inside and outside of X
+	delete(fsys, "X/a")
+	delete(fsys, "Y/c")
+	fsys["X/b"].Data = b3
+	fsys["X/e"] = &fstest.MapFile{Data: b1, ModTime: t0}
+	fsys["f"] = &fstest.MapFile{Data: b2, ModTime: t0}
+
+	tr := x.ToTree()
+	tr.file("X/a").flag = flagKeep
+	tr.file("Y/c").flag = flagJunk
+	var last *Progress
+	s := Scanner{ProgFn: func(p *Progress) { last = p }, Subtree: "X/"}
+	x, err = s.Rescan(context.Background(), tr, fsys)
+	require.NoError(t, err)
+	want := &Index{groups: []Files{
+		{
+			{"X/a", d1, 1, t0, flagKeep | flagGone, nil},
+			{"X/e", d1, 1, t0, flagNone, nil},
+			{"Y/c", d1, 1, t0, flagJunk, nil},
+		}, {
+			{"X/b", d3, 3, t0, flagNone, nil},
+			{"d", d3, 3, t0, flagNone, nil},
+		},
+	}}
+	require.Equal(t, want, x)
+	files, bytes := last.Total()
+	require.Equal(t, [2]uint64{2, 3}, [2]uint64{files, bytes})
+
+	// Invalid subtrees
+	for _, sub := range []string{"../X", "Z", "d"} {
+		s := Scanner{Subtree: sub}
+		_, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+		require.Error(t, err, "%s", sub)
+	}
+}
+
+func TestScanMoves(t *testing.T) {
+	b1, d1 := testData("1")
+	b2, d2 := testData("2")
+	b3, d3 := testData("3")
+	t0 := time.Now()
+	t1 := t0.Add(time.Second)
+	t2 := t1.Add(time.Second)
+	t3 := t2.Add(time.Second)
+	fsys := fstest.MapFS{
+		"a": {Data: b1, ModTime: t0},
+		"b": {Data: b2, ModTime: t1},
+		"c": {Data: b3, ModTime: t1},
+		"d": {Data: b1, ModTime: t3},
+		"e": {Data: b3, ModTime: t2},
+		"f": {Data: b2, ModTime: t3},
+		"z": {ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	tr := x.ToTree()
+	tr.file("a").flag = flagKeep
+	tr.file("d").flag = flagDup
+
+	// a is moved and renamed; b and c have the same size and modtime, but b
+	// keeps its name; e is copied; d and f are ambiguous; and z is empty.
+	mv := func(from, to string) {
+		fsys[to] = fsys[from]
+		delete(fsys, from)
+	}
+	mv("a", "X/a2")
+	mv("b", "X/b")
+	mv("c", "X/c2")
+	mv("d", "X/d2")
+	fsys["X/e"] = fsys["e"]
+	mv("f", "X/f2")
+	mv("z", "X/z")
+	var last *Progress
+	s := Scanner{ProgFn: func(p *Progress) { last = p }, Moves: true}
+	x, err = s.Rescan(context.Background(), tr, fsys)
+	require.NoError(t, err)
+	files, _ := last.Reused()
+	assert.Equal(t, uint64(4), files)
+
+	have := make(map[path]*File)
+	for _, f := range x.Files() {
+		require.NotContains(t, have, f.path)
+		have[f.path] = f
+	}
+	assert.Len(t, have, 9)
+	want := func(p path, d Digest, flag Flag) {
+		t.Helper()
+		require.Contains(t, have, p)
+		assert.Equal(t, d, have[p].digest, "%s", p)
+		assert.Equal(t, flag, have[p].flag, "%s", p)
+	}
+	want("X/a2", d1, flagKeep|flagSame)
+	want("X/b", d2, flagSame)
+	want("X/c2", d3, flagSame)
+	want("X/d2", d1, flagNone)
+	want("X/e", d3, flagNone)
+	want("X/f2", d2, flagNone)
+	want("d", d1, flagDup|flagGone)
+	want("e", d3, flagSame)
+	require.Contains(t, have, path("X/z"))
+	assert.Equal(t, flagNone, have["X/z"].flag)
+}
+
+func TestScanMoveCheck(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	a := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(a)
+	b := bytes.Clone(a)
+	b[0]++
+	scan := func(s Scanner) *Tree {
+		x, err := s.Scan(context.Background(), fstest.MapFS{
+			"a": {Data: a, ModTime: t0},
+			"b": {Data: b, ModTime: t0.Add(time.Second)},
+			"c": {Data: []byte("c"), ModTime: t0},
+		})
+		require.NoError(t, err)
+		return x.ToTree()
+	}
+	db := scan(Scanner{}).File("b").digest
+
+	// All files are moved and b is replaced by different contents of the same
+	// size and modification time
+	b2 := bytes.Clone(b)
+	b2[len(b2)-1]++
+	fsys := fstest.MapFS{
+		"X/a": {Data: a, ModTime: t0},
+		"X/b": {Data: b2, ModTime: t0.Add(time.Second)},
+		"X/c": {Data: []byte("c"), ModTime: t0},
+	}
+	rescan := func(s Scanner) *Tree {
+		s.Moves = true
+		x, err := s.Rescan(context.Background(), scan(s), fsys)
+		require.NoError(t, err)
+		return x.ToTree()
+	}
+	tr := rescan(Scanner{ChunkSize: MinChunkSize, MoveCheck: true})
+	assert.Equal(t, flagSame, tr.File("X/a").flag)
+	assert.Equal(t, flagSame, tr.File("X/c").flag)
+	assert.Equal(t, flagNone, tr.File("X/b").flag)
+	assert.NotEqual(t, db, tr.File("X/b").digest)
+
+	// Without the check, the modified file reuses the old digest
+	tr = rescan(Scanner{ChunkSize: MinChunkSize})
+	assert.Equal(t, flagSame, tr.File("X/b").flag)
+	assert.Equal(t, db, tr.File("X/b").digest)
+
+	// Files without chunks are hashed again
+	tr = rescan(Scanner{MoveCheck: true})
+	assert.Equal(t, flagNone, tr.File("X/a").flag)
+}
+
+func TestScanRetries(t *testing.T) {
+	fsys := &unstableFS{MapFS: fstest.MapFS{
+		"a": {Data: []byte("a")},
+		"b": {Data: []byte("b")},
+	}, left: map[string]int{"a": 2, "b": 100}}
+	var errs []error
+	s := Scanner{
+		ErrFn:      func(err error) { errs = append(errs, err) },
+		Retries:    3,
+		RetryDelay: time.Millisecond,
+	}
+	x, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "modified while reading: b")
+	require.Equal(t, []*FileError{{ModifiedErr, "b", nil}}, x.Errors())
+	require.Len(t, x.Files(), 1)
+	require.Equal(t, path("a"), x.Files()[0].path)
+
+	// Volatile files are persisted and retried by the next scan
+	var buf bytes.Buffer
+	require.NoError(t, x.write(&buf))
+	x, err = read(&buf)
+	require.NoError(t, err)
+	require.Equal(t, []*FileError{{ModifiedErr, "b", nil}}, x.Errors())
+	fsys.left["b"] = 0
+	x, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	require.Empty(t, x.Errors())
+	require.Len(t, x.Files(), 2)
+}
+
+func TestScanErrors(t *testing.T) {
+	fsys := &failFS{MapFS: fstest.MapFS{
+		"A/a":   {Data: []byte("a")},
+		"A/b":   {Data: []byte("b")},
+		"B/C/c": {Data: []byte("c")},
+		"B/d\n": {Data: []byte("d")},
+		"B/e":   {Data: []byte("e")},
+	}, fail: map[string]bool{"A/b": true, "B/C": true}}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	want := []*FileError{
+		{OpenErr, "A/b", nil},
+		{PathErr, "B/", nil},
+		{WalkErr, "B/C/", nil},
+	}
+	require.Equal(t, want, x.Errors())
+	require.Len(t, x.Files(), 2) // A/a and B/e
+
+	// Errors are retried
+	fsys.fail = nil
+	delete(fsys.MapFS, "B/d\n")
+	x, err = x.ToTree().Rescan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, x.Errors())
+	require.Len(t, x.Files(), 4)
+
+	// Walk errors for invalid names are reported as path errors
+	vfs := &vanishFS{MapFS: fstest.MapFS{"D\n/f": {Data: []byte("f")}}, left: map[string]int{"D\n": 1}}
+	var errs []error
+	s := Scanner{ErrFn: func(err error) { errs = append(errs, err) }, Subtree: "D\n"}
+	x, err = s.Rescan(context.Background(), x.ToTree(), vfs)
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	var fe *FileError
+	require.ErrorAs(t, errs[0], &fe)
+	require.Equal(t, PathErr, fe.Kind)
+	var buf bytes.Buffer
+	require.NoError(t, x.write(&buf))
+	_, err = read(&buf)
+	require.NoError(t, err)
+}
+
+// failFS returns fs.ErrPermission when opening or reading any path in fail.
+type failFS struct {
+	fstest.MapFS
+	fail map[string]bool
+}
+
+func (f *failFS) Open(name string) (fs.File, error) {
+	if f.fail[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.Open(name)
+}
+
+func (f *failFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if f.fail[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+// vanishFS fails to stat each path in left after the specified number of
+// successful calls.
+type vanishFS struct {
+	fstest.MapFS
+	left map[string]int
+}
+
+func (v *vanishFS) Stat(name string) (fs.FileInfo, error) {
+	if n, ok := v.left[name]; ok {
+		if n == 0 {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrPermission}
+		}
+		v.left[name] = n - 1
+	}
+	return v.MapFS.Stat(name)
+}
+
+// unstableFS reports a different modification time for the next n stat calls
+// of each file in left.
+type unstableFS struct {
+	fstest.MapFS
+	mu   sync.Mutex
+	left map[string]int
+}
+
+func (u *unstableFS) Stat(name string) (fs.FileInfo, error) {
+	fi, err := u.MapFS.Stat(name)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err == nil && u.left[name] > 0 {
+		u.left[name]--
+		fi = unstableInfo{fi}
+	}
+	return fi, err
+}
+
+type unstableInfo struct{ fs.FileInfo }
+
+func (fi unstableInfo) ModTime() time.Time { return fi.FileInfo.ModTime().Add(time.Second) }
+
+func TestLimiter(t *testing.T) {
+	l := limiter{rate: 1000}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait(nil, 20)
+	}
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	cancel := make(chan struct{})
+	close(cancel)
+	start = time.Now()
+	l.wait(cancel, 1e6)
+	require.Less(t, time.Since(start), time.Second)
 }
 
 func TestDirFSRoot(t *testing.T) {
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Seed returns a tree that can be used to rescan root, reusing digests of files
+// from existing indexes instead of hashing them again. Seed paths are mapped to
+// root by comparing index roots. If root is inside a seed's root, only the
+// files under root are used. If a seed's root is inside root, its files are
+// moved into the corresponding subdirectory. Otherwise, such as when root is a
+// copy of the seed's root, paths are used as they are. The first seed that
+// contains a path is used for that path. Flags, removed files, errors, empty
+// files, whose digests depend on their names, and files with partial digests
+// are not copied. The tree uses the hash algorithm of the first seed. Seeds
+// that use a different algorithm are ignored.
+func Seed(root string, seeds ...*Index) *Tree {
+	seen := make(map[path]struct{})
+	var all Files
+	var alg Algorithm
+	for i, x := range seeds {
+		if i == 0 {
+			alg = x.hash
+		} else if x.hash != alg {
+			continue
+		}
+		strip, prefix := seedMapping(root, x.root)
+		for _, g := range x.groups {
+			for _, f := range g {
+				if f.size == 0 || f.flag.IsGone() || f.flag.IsPartial() || !strip.contains(f.path) {
+					continue
+				}
+				p := f.path
+				if strip != "." {
+					p = p[len(strip):]
+				}
+				if prefix != "." {
+					p = prefix + p
+				}
+				if _, dup := seen[p]; dup {
+					continue
+				}
+				seen[p] = struct{}{}
+				all = append(all, &File{p, f.digest, f.size, f.modTime, flagNone, f.sums})
+			}
+		}
+	}
+	all.Sort()
+	x := New(root, all)
+	x.hash = alg
+	return x.ToTree()
+}
+
+// seedMapping returns the directory prefix that must be removed from and added
+// to seed paths to make them relative to root.
+func seedMapping(root, seed string) (strip, prefix path) {
+	strip, prefix = ".", "."
+	if root == "" || seed == "" {
+		return
+	}
+	root, err1 := filepath.Abs(root)
+	seed, err2 := filepath.Abs(seed)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	if rel, ok := relPath(seed, root); ok {
+		strip = rel
+	} else if rel, ok = relPath(root, seed); ok {
+		prefix = rel
+	}
+	return
+}
+
+// relPath returns the directory path of target relative to base if target is
+// base or one of its subdirectories.
+func relPath(base, target string) (path, bool) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	c := cleanPath(rel)
+	if c == "" {
+		return "", false
+	}
+	return dirPath(c), true
+}
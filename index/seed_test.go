@@ -0,0 +1,75 @@
+package index
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	d1, d2, d3 := Digest{1}, Digest{2}, Digest{3}
+	t0 := time.Now()
+	abs := func(p string) string {
+		p, err := filepath.Abs(filepath.FromSlash(p))
+		require.NoError(t, err)
+		return p
+	}
+	seed := New(abs("/data"), Files{
+		{"A/x", d1, 1, t0, flagKeep, nil},
+		{"A/y", d2, 2, t0, flagNone, nil},
+		{"A/z", Digest{4}, 0, t0, flagNone, nil},
+		{"A/w", d3, 3, t0, flagDup | flagGone, nil},
+		{"B/x", d1, 1, t0, flagNone, nil},
+	})
+	paths := func(tr *Tree) (ps []path) {
+		for _, f := range tr.ToIndex().Files() {
+			assert.Equal(t, flagNone, f.flag)
+			ps = append(ps, f.path)
+		}
+		return
+	}
+	assert.Equal(t, []path{"A/x", "A/y", "B/x"}, paths(Seed(abs("/copy"), seed)))
+	assert.Equal(t, []path{"A/x", "A/y", "B/x"}, paths(Seed(abs("/data"), seed)))
+	assert.Equal(t, []path{"x", "y"}, paths(Seed(abs("/data/A"), seed)))
+	assert.Equal(t, []path{"data/A/x", "data/A/y", "data/B/x"}, paths(Seed(abs("/"), seed)))
+	assert.Empty(t, paths(Seed(abs("/data/C"), seed)))
+
+	// First seed wins
+	other := New(abs("/data/A"), Files{
+		{"x", d2, 2, t0, flagNone, nil},
+		{"v", d3, 3, t0, flagNone, nil},
+	})
+	tr := Seed(abs("/data/A"), other, seed)
+	assert.Equal(t, []path{"v", "x", "y"}, paths(tr))
+	assert.Equal(t, d2, tr.file("x").digest)
+}
+
+func TestScanSeed(t *testing.T) {
+	b1, d1 := testData("1")
+	b2, _ := testData("2")
+	t0 := time.Now()
+	seed := New("", Files{
+		{"a", Digest{1}, 1, t0, flagNone, nil}, // Reused even if wrong
+		{"b", d1, 1, t0, flagNone, nil},
+	})
+	fsys := fstest.MapFS{
+		"a": {Data: b1, ModTime: t0},
+		"b": {Data: b2, ModTime: t0.Add(time.Second)},
+		"c": {Data: b2, ModTime: t0},
+	}
+	var last *Progress
+	s := Scanner{ProgFn: func(p *Progress) { last = p }}
+	x, err := s.Rescan(context.Background(), Seed("", seed), fsys)
+	require.NoError(t, err)
+	files, _ := last.Reused()
+	require.Equal(t, uint64(1), files)
+	tr := x.ToTree()
+	require.Equal(t, Digest{1}, tr.file("a").digest)
+	require.NotEqual(t, d1, tr.file("b").digest)
+	require.Len(t, x.Files(), 3)
+}
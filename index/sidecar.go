@@ -0,0 +1,268 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/fs"
+	stdpath "path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SidecarCheck is the result of checking the sidecar checksum files found in
+// an index, such as SHA256SUMS or *.md5 files produced by other tools.
+type SidecarCheck struct {
+	Sidecars []string        // Checksum files that were checked
+	Matched  []*SidecarEntry // Listed files whose contents match
+	Mismatch []*SidecarEntry // Listed files whose contents do not match
+	Missing  []*SidecarEntry // Listed files that are not indexed or unreadable
+	Invalid  int             // Lines that could not be parsed
+}
+
+// SidecarEntry is a file listed in a sidecar checksum file.
+type SidecarEntry struct {
+	Sidecar string    // Checksum file path
+	Path    string    // Listed file path relative to the index root
+	Alg     Algorithm // Checksum algorithm
+	Want    []byte    // Listed digest
+	Have    []byte    // Actual digest or nil if the file is missing
+	Err     error     // Error encountered while reading the file
+}
+
+// sidecarFormat is the format of a sidecar checksum file.
+type sidecarFormat uint8
+
+const (
+	sumsFormat sidecarFormat = iota // "<hex>  <name>" lines (md5sum and others)
+	sfvFormat                       // "<name> <crc32>" lines
+)
+
+// sidecarNames maps lowercase names of sidecar files to their algorithms.
+var sidecarNames = map[string]Algorithm{
+	"b3sums":     BLAKE3,
+	"md5sums":    MD5,
+	"sha1sums":   SHA1,
+	"sha256sums": SHA256,
+}
+
+// sidecarExts maps lowercase extensions of sidecar files to their algorithms.
+var sidecarExts = map[string]Algorithm{
+	".b3":     BLAKE3,
+	".md5":    MD5,
+	".sfv":    CRC32,
+	".sha1":   SHA1,
+	".sha256": SHA256,
+}
+
+// sidecar returns the algorithm and format of the sidecar checksum file with
+// the specified base name.
+func sidecar(name string) (Algorithm, sidecarFormat, bool) {
+	lower := strings.ToLower(name)
+	if a, ok := sidecarNames[strings.TrimSuffix(lower, ".txt")]; ok {
+		return a, sumsFormat, true
+	}
+	a, ok := sidecarExts[stdpath.Ext(lower)]
+	if a == CRC32 {
+		return a, sfvFormat, ok
+	}
+	return a, sumsFormat, ok
+}
+
+// CheckSidecars finds sidecar checksum files in t and checks the files that
+// they list. Supported files are B3SUMS, MD5SUMS, SHA1SUMS, SHA256SUMS (with an
+// optional .txt extension), and files with .b3, .md5, .sfv, .sha1, or .sha256
+// extensions. Listed names are relative to the directory of the checksum file.
+// A .md5, .sha1, .sha256, or .b3 file may also contain a single digest without
+// a name for the file with the same name minus the extension.
+//
+// Digests are taken from the index if it has the required primary or secondary
+// digests (see Scanner.Secondary), which avoids reading the listed files again.
+// All other files are hashed. A non-nil error is returned if ctx is canceled.
+func (s *Scanner) CheckSidecars(ctx context.Context, t *Tree, fsys fs.FS) (*SidecarCheck, error) {
+	var sidecars Files
+	for _, g := range t.idx {
+		for _, f := range g {
+			if _, _, ok := sidecar(f.base()); ok && !f.flag.IsGone() {
+				sidecars = append(sidecars, f)
+			}
+		}
+	}
+	sidecars.Sort()
+	c := &SidecarCheck{}
+	var entries []*SidecarEntry
+	for _, f := range sidecars {
+		b, err := fs.ReadFile(fsys, string(f.path))
+		if err != nil {
+			if s.ErrFn != nil {
+				s.ErrFn(fileError(ReadErr, string(f.path), err))
+			}
+			continue
+		}
+		c.Sidecars = append(c.Sidecars, string(f.path))
+		var n int
+		entries, n = parseSidecar(entries, f.path, b)
+		c.Invalid += n
+	}
+
+	// Use existing digests
+	type job struct {
+		path string
+		algs []Algorithm // Required secondary algorithms
+		all  []*SidecarEntry
+	}
+	var todo []*job
+	jobs := make(map[string]*job)
+	for _, e := range entries {
+		f := t.file(path(e.Path))
+		if f == nil || f.flag.IsGone() {
+			c.Missing = append(c.Missing, e)
+			continue
+		}
+		if !f.flag.IsPartial() {
+			e.Have = sidecarDigest(e.Alg, t.hash, f, t.sums[f.digest])
+		}
+		if e.Have != nil {
+			continue
+		}
+		j := jobs[e.Path]
+		if j == nil {
+			j = &job{path: e.Path}
+			jobs[e.Path] = j
+			todo = append(todo, j)
+		}
+		if e.Alg != t.hash && !slices.Contains(j.algs, e.Alg) {
+			j.algs = append(j.algs, e.Alg)
+		}
+		j.all = append(j.all, e)
+	}
+
+	// Hash each remaining file once, computing all of its required digests in
+	// one pass
+	if len(todo) > 0 {
+		cfg := *s
+		cfg.XattrCache, cfg.Hash, cfg.Secondary = false, t.hash, nil
+		cp := ctxPoller(ctx.Done())
+		var prog *Progress
+		var tick func()
+		var hashed atomic.Uint64
+		if s.ProgFn != nil {
+			prog = newProgress(time.Now())
+			for _, j := range todo {
+				prog.totalFiles++
+				prog.totalBytes += uint64(t.file(path(j.path)).size)
+			}
+			tick = func() {
+				prog.sampleFiles += hashed.Swap(0)
+				prog.update(time.Now())
+				s.ProgFn(prog)
+			}
+		}
+		w := &walker{Scanner: &cfg, fsys: fsys}
+		mon := cfg.monitor(cp, prog)
+		cfg.parallel(cp, len(todo), mon, tick, func(error) {}, func(h *Hasher, i int) error {
+			j := todo[i]
+			h.setSums(j.algs)
+			f, err := w.read(cp, h, j.path)
+			for _, e := range j.all {
+				if err != nil {
+					e.Err = err
+				} else {
+					e.Have = sidecarDigest(e.Alg, t.hash, f, h.Sums())
+				}
+			}
+			if err == nil {
+				hashed.Add(1)
+			}
+			return err
+		})
+		if prog != nil {
+			prog.sampleFiles += hashed.Swap(0)
+		}
+		s.finalProgress(prog)
+		if cp.canceled() {
+			return nil, ctx.Err()
+		}
+	}
+
+	// Compare digests. Read errors are reported once per file.
+	reported := make(map[error]bool)
+	for _, e := range entries {
+		switch {
+		case e.Err != nil:
+			if s.ErrFn != nil && !reported[e.Err] {
+				reported[e.Err] = true
+				s.ErrFn(e.Err)
+			}
+			c.Missing = append(c.Missing, e)
+		case e.Have == nil:
+			// Already in Missing
+		case bytes.Equal(e.Have, e.Want):
+			c.Matched = append(c.Matched, e)
+		default:
+			c.Mismatch = append(c.Mismatch, e)
+		}
+	}
+	return c, nil
+}
+
+// sidecarDigest returns the alg digest of file f, which has primary algorithm
+// primary and secondary digests sums, or nil if the digest is not available.
+func sidecarDigest(alg, primary Algorithm, f *File, sums Sums) []byte {
+	switch {
+	case f.size == 0:
+		return alg.new().Sum(nil) // Primary digest is name-based
+	case alg == primary:
+		return f.digest[:]
+	}
+	return sums[alg]
+}
+
+// parseSidecar appends the entries of sidecar checksum file p with contents b
+// to all. It returns the number of lines that could not be parsed.
+func parseSidecar(all []*SidecarEntry, p path, b []byte) ([]*SidecarEntry, int) {
+	alg, format, _ := sidecar(p.base())
+	dir, ext := p.dir(), stdpath.Ext(p.base())
+	if _, ok := sidecarExts[strings.ToLower(ext)]; !ok {
+		ext = "" // Named sidecar, such as SHA256SUMS
+	}
+	var invalid int
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		ln := strings.TrimSuffix(s.Text(), "\r")
+		if t := strings.TrimSpace(ln); t == "" || t[0] == ';' || t[0] == '#' {
+			continue
+		}
+		var name string
+		var want []byte
+		var err error
+		switch format {
+		case sumsFormat:
+			if e, ok := ParseManifestLine(ln); ok {
+				name, want = e.Name, e.Sum
+			} else if ext != "" {
+				// Single digest for the file named after the sidecar
+				want, err = hex.DecodeString(strings.TrimSpace(ln))
+				name = strings.TrimSuffix(p.base(), ext)
+			}
+		case sfvFormat:
+			ln := strings.TrimSpace(ln)
+			if i := strings.LastIndexByte(ln, ' '); i > 0 {
+				name = strings.TrimSpace(ln[:i])
+				want, err = hex.DecodeString(strings.TrimSpace(ln[i+1:]))
+			}
+		}
+		// Sidecars created on Windows use backslash separators
+		name = strings.ReplaceAll(name, `\`, "/")
+		c := path(cleanPath(stdpath.Join(string(dir), name)))
+		if err != nil || name == "" || len(want) != alg.size() || !c.isFile() || stdpath.IsAbs(name) {
+			invalid++
+			continue
+		}
+		all = append(all, &SidecarEntry{Sidecar: string(p), Path: string(c), Alg: alg, Want: want})
+	}
+	return all, invalid
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSidecars(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	md5hex := func(s string) string { d := md5.Sum([]byte(s)); return hex.EncodeToString(d[:]) }
+	sha256hex := func(s string) string { d := sha256.Sum256([]byte(s)); return hex.EncodeToString(d[:]) }
+	fsys := fstest.MapFS{
+		"a":            {Data: []byte("a"), ModTime: t0},
+		"a.md5":        {Data: []byte(md5hex("a") + "\n"), ModTime: t0},
+		"d/b":          {Data: []byte("b"), ModTime: t0},
+		"d/c":          {Data: []byte("c"), ModTime: t0},
+		"d/e":          {ModTime: t0},
+		"d/SHA256SUMS": {Data: []byte(sha256hex("b") + "  b\n" + sha256hex("x") + " *c\n" + sha256hex("") + "  e\n"), ModTime: t0},
+		"all.sfv": {Data: []byte(fmt.Sprintf("; comment\r\na %08X\r\nd/b %08x \r\nd\\e 00000000\r\nmissing 00000000\r\ninvalid\r\n",
+			crc32.ChecksumIEEE([]byte("a")), crc32.ChecksumIEEE([]byte("b")))), ModTime: t0},
+	}
+	for _, secondary := range [][]Algorithm{nil, {MD5, SHA256, CRC32}} {
+		s := &Scanner{Secondary: secondary}
+		x, err := s.Scan(context.Background(), fsys)
+		require.NoError(t, err)
+		var hashed uint64
+		s.ProgFn = func(p *Progress) {
+			if p.IsFinal() {
+				hashed, _ = p.Hashed()
+			}
+		}
+		c, err := s.CheckSidecars(context.Background(), x.ToTree(), fsys)
+		require.NoError(t, err)
+		if secondary == nil {
+			assert.Equal(t, uint64(3), hashed) // Each file is only read once
+		} else {
+			assert.Zero(t, hashed)
+		}
+		assert.Equal(t, []string{"d/SHA256SUMS", "a.md5", "all.sfv"}, c.Sidecars)
+		assert.Equal(t, 1, c.Invalid)
+		var matched []string
+		for _, e := range c.Matched {
+			matched = append(matched, e.Alg.String()+":"+e.Path)
+		}
+		assert.Equal(t, []string{"sha256:d/b", "sha256:d/e", "md5:a", "crc32:a", "crc32:d/b", "crc32:d/e"}, matched)
+		require.Len(t, c.Mismatch, 1)
+		assert.Equal(t, "d/c", c.Mismatch[0].Path)
+		require.Len(t, c.Missing, 1)
+		assert.Equal(t, "missing", c.Missing[0].Path)
+	}
+}
+
+func TestSidecarName(t *testing.T) {
+	for name, want := range map[string]Algorithm{
+		"SHA256SUMS": SHA256, "sha1sums.txt": SHA1, "x.MD5": MD5, "y.sfv": CRC32, "B3SUMS": BLAKE3,
+	} {
+		a, _, ok := sidecar(name)
+		assert.True(t, ok, "%s", name)
+		assert.Equal(t, want, a, "%s", name)
+	}
+	for _, name := range []string{"a", "sums", "SHA512SUMS", "md5"} {
+		_, _, ok := sidecar(name)
+		assert.False(t, ok, "%s", name)
+	}
+}
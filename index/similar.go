@@ -0,0 +1,171 @@
+package index
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Similar is a pair of files with different contents that share chunks.
+type Similar struct {
+	A, B   *File
+	Shared int64   // Size of distinct chunks in both files
+	Ratio  float64 // Shared size divided by the size of distinct chunks in either file
+}
+
+// ChunkStats estimates the space required to store all existing files with
+// whole-file and chunk-level deduplication.
+type ChunkStats struct {
+	Files      int   // Existing non-empty files
+	Size       int64 // Total allocated size of existing files
+	FileDedup  int64 // Allocated size after whole-file deduplication
+	ChunkDedup int64 // Size after chunk-level deduplication
+	Chunks     int   // Distinct chunks
+	Unchunked  int   // Unique files without known chunks, counted as whole files
+}
+
+// maxChunkRefs is the maximum number of unique files that may share a chunk
+// for it to be used for finding similar files. Chunks that are common to many
+// files, such as those consisting of zeros, are a poor similarity signal and
+// would make the search quadratic in the number of files. Chunks shared by
+// more files are ignored entirely, so they neither make files similar nor
+// reduce the similarity of files that share other chunks.
+const maxChunkRefs = 64
+
+// Similar returns pairs of existing files with different contents that share
+// at least minRatio of their distinct chunks, ordered by decreasing ratio.
+// Chunks shared by more than maxChunkRefs files are not counted. Files with
+// identical contents are already duplicates and are represented by one file.
+// Files with fewer than two chunks are ignored. The index must have been
+// created with content-defined chunking.
+func (t *Tree) Similar(minRatio float64) []*Similar {
+	type chunkRefs struct {
+		size  int64
+		files []int32
+	}
+	var files Files
+	var sizes []int64 // Size of distinct usable chunks in each file
+	refs := make(map[Digest]*chunkRefs)
+	for _, g := range t.idx {
+		f := existing(g)
+		if f == nil {
+			continue
+		}
+		c := fileChunks(f, t.chunks, t.csize)
+		if len(c) < 2 {
+			continue
+		}
+		i, size := int32(len(files)), int64(0)
+		for _, k := range c {
+			r := refs[k.Digest]
+			if r == nil {
+				r = &chunkRefs{size: k.Size}
+				refs[k.Digest] = r
+			} else if n := len(r.files); n > 0 && r.files[n-1] == i {
+				continue // Repeated chunk
+			}
+			r.files = append(r.files, i)
+			size += k.Size
+		}
+		files, sizes = append(files, f), append(sizes, size)
+	}
+
+	// Sum the sizes of shared chunks for each pair of files
+	shared := make(map[[2]int32]int64)
+	for _, r := range refs {
+		if len(r.files) > maxChunkRefs {
+			for _, i := range r.files {
+				sizes[i] -= r.size
+			}
+			continue
+		}
+		if len(r.files) < 2 {
+			continue
+		}
+		for i, a := range r.files {
+			for _, b := range r.files[i+1:] {
+				shared[[2]int32{a, b}] += r.size
+			}
+		}
+	}
+	var all []*Similar
+	for p, n := range shared {
+		r := float64(n) / float64(sizes[p[0]]+sizes[p[1]]-n)
+		if r < minRatio {
+			continue
+		}
+		a, b := files[p[0]], files[p[1]]
+		if b.path.cmp(a.path) < 0 {
+			a, b = b, a
+		}
+		all = append(all, &Similar{a, b, n, r})
+	}
+	slices.SortFunc(all, func(a, b *Similar) int {
+		if c := cmp.Compare(b.Ratio, a.Ratio); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Shared, a.Shared); c != 0 {
+			return c
+		}
+		if c := a.A.path.cmp(b.A.path); c != 0 {
+			return c
+		}
+		return a.B.path.cmp(b.B.path)
+	})
+	return all
+}
+
+// ChunkStats returns the space required to store all existing files with
+// whole-file and chunk-level deduplication, which approximates what a
+// content-addressed backup tool would need before compression. Sparse files
+// are counted by their allocated sizes.
+func (t *Tree) ChunkStats() ChunkStats {
+	var s ChunkStats
+	seen := make(map[Digest]struct{})
+	for _, g := range t.idx {
+		f := existing(g)
+		if f == nil || f.size == 0 {
+			continue
+		}
+		for _, f := range g {
+			if !f.flag.IsGone() {
+				s.Files++
+				s.Size += t.allocated(f)
+			}
+		}
+		s.FileDedup += t.allocated(f)
+		c := fileChunks(f, t.chunks, t.csize)
+		if c == nil {
+			s.Unchunked++
+			s.ChunkDedup += t.allocated(f)
+			continue
+		}
+		for _, k := range c {
+			if _, ok := seen[k.Digest]; !ok {
+				seen[k.Digest] = struct{}{}
+				s.Chunks++
+				s.ChunkDedup += k.Size
+			}
+		}
+	}
+	return s
+}
+
+// allocated returns the number of bytes allocated for existing file f on
+// disk. See Index.Allocated.
+func (t *Tree) allocated(f *File) int64 {
+	if a, ok := t.alloc[f.path]; ok {
+		return a
+	}
+	return f.size
+}
+
+// existing returns the first file in g that was not removed or nil if there
+// are none.
+func existing(g Files) *File {
+	for _, f := range g {
+		if !f.flag.IsGone() {
+			return f
+		}
+	}
+	return nil
+}
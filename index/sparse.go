@@ -0,0 +1,78 @@
+package index
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// extent is a region of a file in the range [off,end).
+type extent struct{ off, end int64 }
+
+// sparseSize returns the allocated size of file name if it has holes. The file
+// is only opened if it has fewer allocated bytes than its size.
+func sparseSize(fsys fs.FS, name string, fi fs.FileInfo) (int64, bool) {
+	a, ok := allocated(fi)
+	if !ok || a >= fi.Size() {
+		return 0, false
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, false
+	}
+	defer func() { _ = f.Close() }()
+	if dataExtents(f, fi) == nil {
+		return 0, false
+	}
+	return a, true
+}
+
+// sparseFile reads a file with holes. Holes are returned as zeros without
+// reading them from the file system, but are still covered by the digest.
+type sparseFile struct {
+	r    io.ReaderAt
+	data []extent // Data regions in ascending order
+	size int64
+	off  int64 // Read offset
+}
+
+func (s *sparseFile) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.off)
+	s.off += int64(n)
+	return n, err
+}
+
+func (s *sparseFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	if rem := s.size - off; int64(len(p)) > rem {
+		p, err = p[:rem], io.EOF
+	}
+	i := sort.Search(len(s.data), func(i int) bool { return s.data[i].end > off })
+	for len(p) > 0 {
+		// Hole
+		z := len(p)
+		if i < len(s.data) {
+			z = int(min(int64(z), max(s.data[i].off-off, 0)))
+		}
+		clear(p[:z])
+		p, n, off = p[z:], n+z, off+int64(z)
+		if len(p) == 0 {
+			break
+		}
+
+		// Data
+		k := int(min(int64(len(p)), s.data[i].end-off))
+		k, rerr := s.r.ReadAt(p[:k], off)
+		p, n, off = p[k:], n+k, off+int64(k)
+		if rerr != nil {
+			if rerr == io.EOF {
+				rerr = io.ErrUnexpectedEOF
+			}
+			return n, rerr
+		}
+		i++
+	}
+	return
+}
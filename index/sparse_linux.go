@@ -0,0 +1,60 @@
+package index
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocated returns the number of bytes allocated for a file with the
+// specified info.
+func allocated(fi fs.FileInfo) (int64, bool) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512, true
+	}
+	return 0, false
+}
+
+// dataExtents returns the data regions of file f using SEEK_DATA and SEEK_HOLE.
+// It returns nil if f is not sparse or if its holes cannot be determined. A
+// file with fewer allocated bytes than its size is not sparse unless it has a
+// hole before EOF, because compressed or inline files are also smaller on
+// disk.
+func dataExtents(f fs.File, fi fs.FileInfo) []extent {
+	alloc, ok := allocated(fi)
+	osf, isOS := f.(*os.File)
+	if !ok || !isOS || alloc >= fi.Size() {
+		return nil
+	}
+	rc, err := osf.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var data []extent
+	_ = rc.Control(func(fd uintptr) {
+		data = make([]extent, 0, 8)
+		for off := int64(0); off < fi.Size(); {
+			start, err := unix.Seek(int(fd), off, unix.SEEK_DATA)
+			if errors.Is(err, unix.ENXIO) {
+				break // No more data
+			}
+			end, err2 := unix.Seek(int(fd), start, unix.SEEK_HOLE)
+			if err != nil || err2 != nil {
+				data = nil
+				break
+			}
+			data = append(data, extent{start, min(end, fi.Size())})
+			off = end
+		}
+		if len(data) == 1 && data[0] == (extent{0, fi.Size()}) {
+			data = nil // No holes
+		}
+		if _, err := unix.Seek(int(fd), 0, unix.SEEK_SET); err != nil {
+			data = nil
+		}
+	})
+	return data
+}
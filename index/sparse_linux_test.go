@@ -0,0 +1,59 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/blake3"
+)
+
+func TestScanSparse(t *testing.T) {
+	dir := t.TempDir()
+	const size = parallelMin
+	f, err := os.Create(filepath.Join(dir, "sparse"))
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 4<<20)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+	fi, err := os.Stat(filepath.Join(dir, "sparse"))
+	require.NoError(t, err)
+	if a, ok := allocated(fi); !ok || a >= size {
+		t.Skip("file system does not support sparse files")
+	}
+
+	alloc, _ := allocated(fi)
+	a, ok := sparseSize(os.DirFS(dir), "sparse", fi)
+	assert.True(t, ok)
+	assert.Equal(t, alloc, a)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "full"), []byte("full"), 0o644))
+	fi, err = os.Stat(filepath.Join(dir, "full"))
+	require.NoError(t, err)
+	_, ok = sparseSize(os.DirFS(dir), "full", fi)
+	assert.False(t, ok)
+	require.NoError(t, os.Remove(filepath.Join(dir, "full")))
+
+	want := make([]byte, size)
+	copy(want[4<<20:], "data")
+	for _, par := range []bool{false, true} {
+		h := NewHasher(nil)
+		if par {
+			h.par = make(chan struct{}, 2)
+		}
+		have, err := h.Read(os.DirFS(dir), "sparse", true)
+		require.NoError(t, err)
+		assert.Equal(t, Digest(blake3.Sum256(want)), have.digest)
+	}
+
+	x, err := Scan(context.Background(), os.DirFS(dir), nil, nil)
+	require.NoError(t, err)
+	sparse := x.Files()[0]
+	assert.Less(t, x.Allocated(sparse), int64(size))
+	x, err = x.ToTree().Rescan(context.Background(), os.DirFS(dir), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, x.Allocated(sparse), x.Allocated(x.Files()[0]))
+}
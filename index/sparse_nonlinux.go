@@ -0,0 +1,11 @@
+//go:build !linux
+
+package index
+
+import "io/fs"
+
+// allocated is not supported on non-Linux systems.
+func allocated(fs.FileInfo) (int64, bool) { return 0, false }
+
+// dataExtents is not supported on non-Linux systems.
+func dataExtents(fs.File, fs.FileInfo) []extent { return nil }
@@ -0,0 +1,45 @@
+package index
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparseFile(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xFF}, 200)
+	want := make([]byte, len(raw))
+	data := []extent{{10, 20}, {100, 150}}
+	for _, e := range data {
+		copy(want[e.off:e.end], raw[e.off:e.end])
+	}
+	newFile := func() *sparseFile {
+		return &sparseFile{r: bytes.NewReader(raw), data: data, size: int64(len(raw))}
+	}
+
+	have, err := io.ReadAll(newFile())
+	require.NoError(t, err)
+	assert.Equal(t, want, have)
+
+	f := newFile()
+	for _, tc := range []struct{ off, n int }{{0, 10}, {5, 10}, {15, 100}, {120, 30}, {150, 50}, {190, 20}} {
+		b := make([]byte, tc.n)
+		n, err := f.ReadAt(b, int64(tc.off))
+		end := min(tc.off+tc.n, len(raw))
+		if end < tc.off+tc.n {
+			assert.Equal(t, io.EOF, err)
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, want[tc.off:end], b[:n], "%+v", tc)
+	}
+
+	// Truncated data
+	f = newFile()
+	f.r = bytes.NewReader(raw[:120])
+	_, err = io.ReadAll(f)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
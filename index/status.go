@@ -0,0 +1,127 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// ChangeKind describes how a path differs from the index.
+type ChangeKind byte
+
+const (
+	Added       ChangeKind = iota + 1 // File is not in the index
+	Modified                          // File size or modification time changed
+	Deleted                           // File no longer exists
+	TypeChanged                       // File is now a directory or another type
+)
+
+// String returns the name of the change.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "new"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	case TypeChanged:
+		return "type-changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", k)
+}
+
+// Change is a difference between the index and the file system.
+type Change struct {
+	Kind ChangeKind
+	Path string
+	Size int64 // Current size for new and modified files, indexed size otherwise
+	File *File // Indexed file, if any
+}
+
+// Status compares the contents of fsys to the tree using only file metadata,
+// without hashing any files. It returns changes sorted by path bytes, because a
+// changed type may cause the same name to refer to both a file and directory.
+// If errFn is non-nil, it is called for any file-specific errors. A non-nil
+// error is returned if ctx is canceled.
+func (t *Tree) Status(ctx context.Context, fsys fs.FS, errFn func(error)) ([]*Change, error) {
+	cp := ctxPoller(ctx.Done())
+	seen := make(map[*File]struct{})
+	var all []*Change
+	add := func(k ChangeKind, name string, size int64, f *File) {
+		if f != nil {
+			seen[f] = struct{}{}
+		}
+		all = append(all, &Change{k, name, size, f})
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, e fs.DirEntry, err error) error {
+		if cp.canceled() {
+			return fs.SkipAll
+		}
+		if err != nil {
+			if errFn != nil {
+				errFn(fileError(WalkErr, name, err))
+			}
+			return nil
+		}
+		if !validName(name) {
+			if errFn != nil {
+				errFn(fileError(PathErr, name, nil))
+			}
+			if e.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if name == "." {
+			return nil
+		}
+		f := t.file(path(name))
+		switch {
+		case e.Type().IsRegular():
+			fi, err := e.Info()
+			if err != nil {
+				if errFn != nil {
+					errFn(fileError(StatErr, name, err))
+				}
+				if f != nil {
+					seen[f] = struct{}{}
+				}
+				return nil
+			}
+			if f != nil {
+				if f.isSame(t.mtime, fi, nil) {
+					seen[f] = struct{}{}
+				} else {
+					add(Modified, name, fi.Size(), f)
+				}
+			} else if t.dirs[path(name+"/")] != nil {
+				add(TypeChanged, name, fi.Size(), nil)
+			} else {
+				add(Added, name, fi.Size(), nil)
+			}
+		case f != nil:
+			add(TypeChanged, name, f.size, f)
+		case !e.IsDir() && errFn != nil:
+			errFn(fileError(TypeErr, name, nil))
+		}
+		return nil
+	})
+	if err != nil && errFn != nil {
+		errFn(fmt.Errorf("index: walk error: %w", err))
+	}
+	if cp.canceled() {
+		return nil, ctx.Err()
+	}
+	for _, d := range t.dirs {
+		for _, f := range d.files {
+			if _, ok := seen[f]; !ok {
+				add(Deleted, string(f.path), f.size, f)
+			}
+		}
+	}
+	slices.SortFunc(all, func(a, b *Change) int { return strings.Compare(a.Path, b.Path) })
+	return all, nil
+}
@@ -0,0 +1,68 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	t0 := time.Now()
+	fsys := fstest.MapFS{
+		"a":   {Data: []byte("a"), ModTime: t0},
+		"b":   {Data: []byte("b"), ModTime: t0},
+		"c":   {Data: []byte("c"), ModTime: t0},
+		"d/e": {Data: []byte("e"), ModTime: t0},
+		"f/g": {Data: []byte("g"), ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	tr := x.ToTree()
+
+	all, err := tr.Status(context.Background(), fsys, nil)
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	fsys["b"].ModTime = t0.Add(time.Second)
+	delete(fsys, "c")
+	fsys["c/x"] = &fstest.MapFile{Data: []byte("xx")}
+	delete(fsys, "d/e")
+	fsys["d"] = &fstest.MapFile{Data: []byte("ddd")}
+	delete(fsys, "f/g")
+	fsys["h"] = &fstest.MapFile{Data: []byte("hhhh")}
+
+	all, err = tr.Status(context.Background(), fsys, nil)
+	require.NoError(t, err)
+	want := []*Change{
+		{Modified, "b", 1, tr.file("b")},
+		{TypeChanged, "c", 1, tr.file("c")},
+		{Added, "c/x", 2, nil},
+		{TypeChanged, "d", 3, nil},
+		{Deleted, "d/e", 1, tr.file("d/e")},
+		{Deleted, "f/g", 1, tr.file("f/g")},
+		{Added, "h", 4, nil},
+	}
+	require.Equal(t, want, all)
+}
+
+func TestStatusInvalidName(t *testing.T) {
+	t0 := time.Now()
+	fsys := fstest.MapFS{
+		"a": {Data: []byte("a"), ModTime: t0},
+		"c": {Data: []byte("c"), ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+
+	// An invalid file name must not skip its siblings
+	fsys["b\n"] = &fstest.MapFile{Data: []byte("b"), ModTime: t0}
+	var errs []error
+	all, err := x.ToTree().Status(context.Background(), fsys, func(err error) { errs = append(errs, err) })
+	require.NoError(t, err)
+	require.Empty(t, all)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "unsupported file path")
+}
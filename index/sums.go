@@ -0,0 +1,194 @@
+package index
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+)
+
+// Sums contains secondary digests of file contents, such as MD5 or SHA-1, which
+// are used to check files against other tools and services. Secondary digests
+// are never used for grouping files.
+type Sums map[Algorithm][]byte
+
+// has returns whether s contains digests for all of the specified algorithms.
+func (s Sums) has(algs []Algorithm) bool {
+	for _, a := range algs {
+		if _, ok := s[a]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sumWriter computes secondary digests.
+type sumWriter struct {
+	algs []Algorithm
+	h    []hash.Hash
+	w    io.Writer // Writer for all hashes
+}
+
+// setSums configures the Hasher to compute secondary digests with the
+// specified algorithms. Large files are hashed sequentially and cached digests
+// are ignored because the secondary digests require reading file contents.
+func (h *Hasher) setSums(algs []Algorithm) {
+	if len(algs) == 0 {
+		h.sums = nil
+		return
+	}
+	s := &sumWriter{algs: algs, h: make([]hash.Hash, len(algs))}
+	w := make([]io.Writer, len(algs))
+	for i, a := range algs {
+		s.h[i] = a.new()
+		w[i] = s.h[i]
+	}
+	s.w = io.MultiWriter(w...)
+	h.sums = s
+}
+
+// Sums returns the secondary digests of the last file that was read or nil if
+// none were computed.
+func (h *Hasher) Sums() Sums { return h.last }
+
+// reset resets all hashes.
+func (s *sumWriter) reset() {
+	for _, h := range s.h {
+		h.Reset()
+	}
+}
+
+// sums returns the current secondary digests.
+func (s *sumWriter) sums() Sums {
+	m := make(Sums, len(s.algs))
+	for i, a := range s.algs {
+		m[a] = s.h[i].Sum(nil)
+	}
+	return m
+}
+
+// validSecondary returns an error if algs contains duplicates or the primary
+// algorithm.
+func validSecondary(primary Algorithm, algs []Algorithm) error {
+	for i, a := range algs {
+		if int(a) >= len(algNames) || a == primary || slices.Contains(algs[:i], a) {
+			return fmt.Errorf("index: invalid secondary hash algorithm: %v", a)
+		}
+	}
+	return nil
+}
+
+// appendSums appends HTAB-separated "name=hex" group attributes for s.
+func appendSums(b []byte, s Sums) []byte {
+	for i, name := range algNames {
+		if d, ok := s[Algorithm(i)]; ok {
+			b = append(b, '\t')
+			b = append(b, name...)
+			b = append(b, '=')
+			b = append(b, hex.EncodeToString(d)...)
+		}
+	}
+	return b
+}
+
+// parseSum parses a "name=hex" group attribute.
+func parseSum(attr string) (Algorithm, []byte, error) {
+	var a Algorithm
+	for i := range attr {
+		if attr[i] == '=' {
+			if err := a.Set(attr[:i]); err != nil {
+				return 0, nil, err
+			}
+			d, err := hex.DecodeString(attr[i+1:])
+			if err == nil && len(d) != a.size() {
+				err = fmt.Errorf("index: invalid %v digest length", a)
+			}
+			return a, d, err
+		}
+	}
+	return 0, nil, fmt.Errorf("index: invalid group attribute: %s", attr)
+}
+
+// Secondary returns the algorithms of secondary digests that are computed for
+// all files.
+func (x *Index) Secondary() []Algorithm { return x.secondary }
+
+// Sums returns the secondary digests of file f or nil if there are none.
+func (x *Index) Sums(f *File) Sums {
+	if f.flag.IsPartial() {
+		return nil
+	}
+	return x.sums[f.digest]
+}
+
+// setSums sets the secondary digests of all files in x, looking up each digest
+// in srcs in order. The digests are also stored in each File.
+func (x *Index) setSums(srcs ...map[Digest]Sums) {
+	x.sums = nil
+	for _, g := range x.groups {
+		var s Sums
+		if !g[0].flag.IsPartial() {
+			for _, src := range srcs {
+				if s = src[g[0].digest]; s != nil {
+					break
+				}
+			}
+		}
+		if s != nil {
+			if x.sums == nil {
+				x.sums = make(map[Digest]Sums)
+			}
+			x.sums[g[0].digest] = s
+		}
+		for _, f := range g {
+			f.sums = s
+		}
+	}
+}
+
+// hasSums returns whether the file with digest d has secondary digests for all
+// of the specified algorithms.
+func (t *Tree) hasSums(d Digest, algs []Algorithm) bool {
+	return len(algs) == 0 || t.sums[d].has(algs)
+}
+
+// reusable returns whether file f has all secondary digests and chunks
+// required by s, so its digest can be reused if the file is unchanged.
+func (t *Tree) reusable(f *File, s *Scanner) bool {
+	return t.hasSums(f.digest, s.Secondary) && t.hasChunks(f, s.ChunkSize)
+}
+
+// addSums records the secondary digests of the file with digest d.
+func (w *walker) addSums(d Digest, s Sums) {
+	if s != nil {
+		w.mu.Lock()
+		if w.sums == nil {
+			w.sums = make(map[Digest]Sums)
+		}
+		w.sums[d] = s
+		w.mu.Unlock()
+	}
+}
+
+// takeSums removes and returns the recorded secondary digests of the file with
+// digest d.
+func (w *walker) takeSums(d Digest) (Sums, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s, ok := w.sums[d]
+	delete(w.sums, d)
+	return s, ok
+}
+
+// setSums sets the secondary digests of all files in x from those recorded by
+// the walker and the base tree t, which may be nil.
+func (w *walker) setSums(x *Index, t *Tree) {
+	var base map[Digest]Sums
+	if t != nil {
+		base = t.sums
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	x.setSums(w.sums, base)
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanSums(t *testing.T) {
+	t0 := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a":   {Data: []byte("a"), ModTime: t0},
+		"b":   {Data: []byte("b"), ModTime: t0},
+		"c/a": {Data: []byte("a"), ModTime: t0},
+	}
+	want := func(f *File) Sums {
+		data := fsys[string(f.path)].Data
+		md, sh := md5.Sum(data), sha1.Sum(data)
+		return Sums{MD5: md[:], SHA1: sh[:]}
+	}
+
+	// Secondary digests are computed and written as group attributes
+	s := &Scanner{Secondary: []Algorithm{SHA1, MD5}}
+	x, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	for _, f := range x.Files() {
+		assert.Equal(t, want(f), x.Sums(f), "%s", f.path)
+		assert.Equal(t, want(f), f.Sums(), "%s", f.path)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, x.write(&buf))
+	assert.Contains(t, buf.String(), "@secondary sha1,md5\n")
+	assert.Contains(t, buf.String(), "\t1\tmd5=0cc175b9c0f1b6a831c399e269772661\tsha1=86f7e437faa5a7fce15d1ddcb9eaeaea377667b8\n")
+	y, err := read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, x.Secondary(), y.Secondary())
+	for _, f := range y.Files() {
+		assert.Equal(t, want(f), y.Sums(f), "%s", f.path)
+		assert.Equal(t, want(f), f.Sums(), "%s", f.path)
+	}
+
+	// Unchanged files without all secondary digests are hashed again
+	x, err = (&Scanner{}).Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	assert.Nil(t, x.Sums(x.Files()[0]))
+	assert.Nil(t, x.Files()[0].Sums())
+	var hashed int
+	s.ProgFn = func(p *Progress) {
+		if p.IsFinal() {
+			n, _ := p.Hashed()
+			hashed = int(n)
+		}
+	}
+	x, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	assert.Equal(t, len(fsys), hashed)
+	x, err = s.Rescan(context.Background(), x.ToTree(), fsys)
+	require.NoError(t, err)
+	assert.Equal(t, 0, hashed)
+	for _, f := range x.Files() {
+		assert.Equal(t, want(f), x.Sums(f), "%s", f.path)
+		assert.Equal(t, want(f), f.Sums(), "%s", f.path)
+	}
+
+	_, err = (&Scanner{Secondary: []Algorithm{BLAKE3}}).Scan(context.Background(), fsys)
+	require.ErrorContains(t, err, "invalid secondary hash algorithm")
+	_, err = read(bytes.NewBufferString("fsx index v2\n/\n\ta\t//\t2009-11-10T23:00:00Z\n\t\t" +
+		"0000000000000000000000000000000000000000000000000000000000000000\t1\tmd5=00\n"))
+	require.ErrorContains(t, err, "invalid group attribute")
+}
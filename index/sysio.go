@@ -0,0 +1,45 @@
+package index
+
+import "fmt"
+
+// IOPriority is the I/O scheduling priority of the current process.
+type IOPriority byte
+
+const (
+	NormalIO IOPriority = iota // Default priority
+	LowIO                      // Lowest best-effort priority
+	IdleIO                     // Only use the disk when no one else is
+)
+
+// String returns the name of the priority.
+func (p IOPriority) String() string {
+	switch p {
+	case NormalIO:
+		return "normal"
+	case LowIO:
+		return "low"
+	case IdleIO:
+		return "idle"
+	}
+	return fmt.Sprintf("IOPriority(%d)", p)
+}
+
+// Set implements flag.Value by setting the priority with the specified name.
+func (p *IOPriority) Set(name string) error {
+	for v := NormalIO; v <= IdleIO; v++ {
+		if v.String() == name {
+			*p = v
+			return nil
+		}
+	}
+	return fmt.Errorf("index: invalid I/O priority: %s", name)
+}
+
+// Apply sets the I/O priority of the current process. It is only supported on
+// Linux.
+func (p IOPriority) Apply() error {
+	if err := p.apply(); err != nil {
+		return fmt.Errorf("index: failed to set %v I/O priority (%w)", p, err)
+	}
+	return nil
+}
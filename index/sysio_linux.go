@@ -0,0 +1,61 @@
+package index
+
+import (
+	"io/fs"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	adviseSequential = unix.FADV_SEQUENTIAL
+	adviseDontNeed   = unix.FADV_DONTNEED
+)
+
+// fadvise issues posix_fadvise for the entire file f if it is an *os.File.
+// Errors are ignored since the advice is only a hint.
+func fadvise(f fs.File, advice int) {
+	if f, ok := f.(*os.File); ok {
+		if rc, err := f.SyscallConn(); err == nil {
+			_ = rc.Control(func(fd uintptr) { _ = unix.Fadvise(int(fd), 0, 0, advice) })
+		}
+	}
+}
+
+// ioprio_set definitions from linux/ioprio.h.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// apply sets the I/O priority of all current process threads. New threads
+// inherit the priority from the thread that creates them.
+func (p IOPriority) apply() error {
+	var prio uintptr
+	switch p {
+	case NormalIO:
+		return nil
+	case LowIO:
+		prio = ioprioClassBE<<ioprioClassShift | 7
+	case IdleIO:
+		prio = ioprioClassIdle << ioprioClassShift
+	}
+	tids, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, e := range tids {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), prio)
+		if errno != 0 && errno != unix.ESRCH {
+			return errno
+		}
+	}
+	return nil
+}
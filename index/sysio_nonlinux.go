@@ -0,0 +1,24 @@
+//go:build !linux
+
+package index
+
+import (
+	"errors"
+	"io/fs"
+)
+
+const (
+	adviseSequential = iota
+	adviseDontNeed
+)
+
+// fadvise is a no-op on non-Linux systems.
+func fadvise(fs.File, int) {}
+
+// apply returns errors.ErrUnsupported for any non-normal priority.
+func (p IOPriority) apply() error {
+	if p == NormalIO {
+		return nil
+	}
+	return errors.ErrUnsupported
+}
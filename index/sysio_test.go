@@ -0,0 +1,34 @@
+package index
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIOPriority(t *testing.T) {
+	var p IOPriority
+	for _, want := range []IOPriority{LowIO, IdleIO, NormalIO} {
+		require.NoError(t, p.Set(want.String()))
+		require.Equal(t, want, p)
+	}
+	require.Error(t, p.Set("high"))
+	require.NoError(t, NormalIO.Apply())
+	if runtime.GOOS != "linux" {
+		require.Error(t, LowIO.Apply())
+	}
+}
+
+func TestScanNoCache(t *testing.T) {
+	root := t.TempDir()
+	testTree(t, root, 8, 1024)
+	want, err := Scan(context.Background(), os.DirFS(root), nil, nil)
+	require.NoError(t, err)
+	s := Scanner{NoCache: true, Rate: 1 << 20}
+	have, err := s.Scan(context.Background(), os.DirFS(root))
+	require.NoError(t, err)
+	require.Equal(t, want.groups, have.groups)
+}
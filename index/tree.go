@@ -11,20 +11,47 @@ import (
 
 // Tree is a directory tree representation of the index.
 type Tree struct {
-	root string
-	dirs map[path]*dir
-	idx  map[Digest]Files
+	root   string
+	hash   Algorithm
+	mtime  TimeTolerance
+	errs   []*FileError
+	alloc  map[path]int64
+	sums   map[Digest]Sums
+	sec    []Algorithm
+	chunks map[Digest][]Chunk
+	csize  int
+	dirs   map[path]*dir
+	idx    map[Digest]Files
 }
 
 // ToTree converts from an index to a tree representation.
 func (x *Index) ToTree() *Tree {
 	if len(x.groups) == 0 {
-		return &Tree{root: x.root, dirs: map[path]*dir{".": {path: "."}}}
+		return &Tree{
+			root:   x.root,
+			hash:   x.hash,
+			mtime:  x.mtime,
+			errs:   x.errs,
+			alloc:  x.alloc,
+			sums:   x.sums,
+			sec:    x.secondary,
+			chunks: x.chunks,
+			csize:  x.chunkSize,
+			dirs:   map[path]*dir{".": {path: "."}},
+		}
 	}
 	t := &Tree{
-		root: x.root,
-		dirs: make(map[path]*dir, len(x.groups)/8),
-		idx:  make(map[Digest]Files, len(x.groups)),
+		root:   x.root,
+		hash:   x.hash,
+		mtime:  x.mtime,
+		errs:   x.errs,
+		alloc:  x.alloc,
+		sums:   x.sums,
+		sec:    x.secondary,
+		chunks: x.chunks,
+		csize:  x.chunkSize,
+		dirs:   make(map[path]*dir, len(x.groups)/8),
+		idx:    make(map[Digest]Files, len(x.groups)),
 	}
 	t.dirs["."] = &dir{path: "."}
 
@@ -80,6 +107,11 @@ func (x *Index) ToTree() *Tree {
 	close(sort)
 	wg.Wait()
 
+	// Mark directories containing paths that could not be indexed
+	for _, e := range x.errs {
+		t.markUnknown(path(e.Path))
+	}
+
 	// Update directory and file counts
 	t.dirs["."].updateCounts()
 	if _, ok := t.dirs[""]; ok { // Sanity check
@@ -95,7 +127,12 @@ func (t *Tree) ToIndex() *Index {
 		all = append(all, g...)
 	}
 	all.Sort()
-	return New(t.root, all)
+	x := New(t.root, all)
+	x.hash, x.mtime, x.errs, x.alloc = t.hash, t.mtime, t.errs, t.alloc
+	x.secondary, x.chunkSize = t.sec, t.csize
+	x.setSums(t.sums)
+	x.setChunks(t.chunks)
+	return x
 }
 
 // File returns the specified file or nil if it does not exist.
@@ -228,6 +265,36 @@ func (t *Tree) Dups(dirName string, maxDups, maxLost int) []*Dup {
 	}
 }
 
+// totals returns the number and total size of all files in the sub directory
+// that are not gone.
+func (t *Tree) totals(sub path) (files, bytes uint64) {
+	for _, g := range t.idx {
+		for _, f := range g {
+			if !f.flag.IsGone() && sub.contains(f.path) {
+				files++
+				bytes += uint64(f.size)
+			}
+		}
+	}
+	return
+}
+
+// snapshot returns copies of all files in the tree.
+func (t *Tree) snapshot() Files {
+	var n int
+	for _, g := range t.idx {
+		n += len(g)
+	}
+	all := make(Files, 0, n)
+	for _, g := range t.idx {
+		for _, f := range g {
+			c := *f
+			all = append(all, &c)
+		}
+	}
+	return all
+}
+
 // addFile adds file f to the tree, creating any required parent directories.
 func (t *Tree) addFile(f *File) {
 	name := f.dir()
@@ -248,6 +315,23 @@ func (t *Tree) addFile(f *File) {
 	}
 }
 
+// markUnknown marks all existing directories containing path p as having
+// unknown content.
+func (t *Tree) markUnknown(p path) {
+	if !p.isDir() {
+		p = p.dir()
+	}
+	for {
+		if d := t.dirs[p]; d != nil {
+			d.unknown = true
+		}
+		if p == "." {
+			return
+		}
+		p = p.dir()
+	}
+}
+
 // dir returns the specified directory or nil if it does not exist.
 func (t *Tree) dir(name string) *dir { return t.dirs[dirPath(name)] }
 
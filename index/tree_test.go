@@ -148,7 +148,7 @@ func TestEmptyTree(t *testing.T) {
 
 	d1 := Digest{1}
 	x := &Index{root: "/", groups: []Files{{
-		{"x", d1, 1, time.Time{}, flagDup | flagGone},
+		{"x", d1, 1, time.Time{}, flagDup | flagGone, nil},
 	}}}
 	want.idx = map[Digest]Files{d1: x.groups[0]}
 	require.Equal(t, want, x.ToTree())
@@ -0,0 +1,177 @@
+package index
+
+import (
+	"context"
+	"io/fs"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Verification is the result of verifying file contents against the index.
+type Verification struct {
+	Verified Files         // Files whose contents match the index
+	Changed  Files         // Files that were modified or removed since indexing
+	Corrupt  []*Corruption // Files whose contents changed without modification
+}
+
+// Corruption is a file whose contents no longer match its digest even though
+// its size and modification time are unchanged.
+type Corruption struct {
+	*File
+	Actual Digest // Digest of the current contents
+	Intact Files  // Copies in the same digest group that still match
+}
+
+// Verify re-hashes files in t that have the same size and modification time as
+// recorded in the index to detect silent data corruption. If sel is non-nil,
+// only files for which it returns true are verified. Files that were modified
+// or removed are reported as changed rather than corrupt. For each corrupt
+// file, other copies in the same digest group are verified to find intact
+// ones. Files with partial digests are not verified. A non-nil error is returned
+// if ctx is canceled.
+func (s *Scanner) Verify(ctx context.Context, t *Tree, fsys fs.FS, sel func(*File) bool) (*Verification, error) {
+	// Cached digests would hide corruption
+	if s.XattrCache || s.Hash != t.hash {
+		c := *s
+		c.XattrCache, c.Hash = false, t.hash
+		s = &c
+	}
+
+	// Select files
+	want := make(map[path]*File)
+	var todo Files
+	for _, g := range t.idx {
+		for _, f := range g {
+			if !f.flag.IsGone() && !f.flag.IsPartial() && f.size > 0 && (sel == nil || sel(f)) {
+				want[f.path] = f
+				todo = append(todo, f)
+			}
+		}
+	}
+	todo.Sort()
+
+	// Setup progress tracking
+	cp := ctxPoller(ctx.Done())
+	var prog *Progress
+	var progTick <-chan time.Time
+	if s.ProgFn != nil {
+		prog = newProgress(time.Now())
+		for _, f := range todo {
+			prog.totalFiles++
+			prog.totalBytes += uint64(f.size)
+		}
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		progTick = t.C
+	}
+
+	// Start hashers
+	file := make(chan *File, 1)
+	changed := make(chan *File)
+	var werr chan error
+	if s.ErrFn != nil {
+		werr = make(chan error, 1)
+	}
+	w := &walker{Scanner: s, fsys: fsys, file: file, werr: werr}
+	if prog != nil {
+		w.active = make([]atomic.Pointer[string], runtime.NumCPU())
+	}
+	go w.check(cp, todo, changed, s.monitor(cp, prog))
+
+	// Compare digests
+	v := new(Verification)
+	var corrupt Files
+	var actual []Digest
+recv:
+	for {
+		select {
+		case f, ok := <-file:
+			if !ok {
+				break recv
+			}
+			orig := want[f.path]
+			if prog != nil {
+				prog.sampleFiles++
+			}
+			if f.size != orig.size || !s.MTime.Equal(f.modTime, orig.modTime) {
+				v.Changed = append(v.Changed, orig) // Modified after stat
+			} else if f.digest != orig.digest {
+				corrupt = append(corrupt, orig)
+				actual = append(actual, f.digest)
+			} else {
+				v.Verified = append(v.Verified, orig)
+			}
+		case f := <-changed:
+			v.Changed = append(v.Changed, f)
+			if prog != nil {
+				prog.totalFiles--
+				prog.totalBytes -= uint64(f.size)
+			}
+		case err := <-werr:
+			s.ErrFn(err)
+		case now := <-progTick:
+			prog.update(now)
+			prog.active = w.activeNames(prog.active)
+			s.ProgFn(prog)
+		}
+	}
+	if prog != nil {
+		prog.final = true
+		prog.update(time.Now())
+		prog.active = prog.active[:0]
+		s.ProgFn(prog)
+	}
+	if cp.canceled() {
+		return nil, ctx.Err()
+	}
+	v.Verified.Sort()
+	v.Changed.Sort()
+
+	// Find intact copies of corrupt files
+	h := s.Hash.NewHasher(s.monitor(cp, nil))
+	h.noCache = s.NoCache
+	for i, f := range corrupt {
+		c := &Corruption{File: f, Actual: actual[i]}
+		for _, alt := range t.idx[f.digest] {
+			if alt == f || alt.flag.IsGone() {
+				continue
+			}
+			if fi, err := fs.Stat(fsys, string(alt.path)); !alt.isSame(s.MTime, fi, err) {
+				continue
+			}
+			if cur, err := h.Read(fsys, string(alt.path), false); err == nil && cur.digest == alt.digest {
+				c.Intact = append(c.Intact, alt)
+			}
+		}
+		if cp.canceled() {
+			return nil, ctx.Err()
+		}
+		c.Intact.Sort()
+		v.Corrupt = append(v.Corrupt, c)
+	}
+	slices.SortFunc(v.Corrupt, func(a, b *Corruption) int { return a.cmp(b.File) })
+	return v, nil
+}
+
+// check sends files that still have the same size and modification time to the
+// hashers and all others to changed.
+func (w *walker) check(cp ctxPoller, files Files, changed chan<- *File, mon func(int) error) {
+	hash := w.start(cp, mon)
+	defer func() {
+		close(hash)
+		w.wg.Wait()
+		close(w.file)
+	}()
+	for _, f := range files {
+		if cp.canceled() {
+			return
+		}
+		if fi, err := fs.Stat(w.fsys, string(f.path)); !f.isSame(w.MTime, fi, err) {
+			changed <- f
+			continue
+		}
+		hash <- string(f.path)
+	}
+}
@@ -0,0 +1,49 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	t0 := time.Now()
+	fsys := fstest.MapFS{
+		"a":   {Data: []byte("a"), ModTime: t0},
+		"b/a": {Data: []byte("a"), ModTime: t0},
+		"c/a": {Data: []byte("a"), ModTime: t0},
+		"d":   {Data: []byte("d"), ModTime: t0},
+		"e":   {Data: []byte("e"), ModTime: t0},
+		"f":   {Data: []byte("f"), ModTime: t0},
+	}
+	x, err := Scan(context.Background(), fsys, nil, nil)
+	require.NoError(t, err)
+	tr := x.ToTree()
+
+	fsys["a"].Data = []byte("x")      // Corrupt
+	fsys["c/a"].Data = []byte("y")    // Corrupt
+	fsys["d"].ModTime = t0.Add(-1)    // Modified
+	delete(fsys, "e")                 // Removed
+	fsys["f"].Data = []byte("longer") // Modified
+
+	var s Scanner
+	v, err := s.Verify(context.Background(), tr, fsys, func(f *File) bool { return f.path != "b/a" })
+	require.NoError(t, err)
+	require.Empty(t, v.Verified)
+	require.Equal(t, Files{tr.file("d"), tr.file("e"), tr.file("f")}, v.Changed)
+	require.Len(t, v.Corrupt, 2)
+	require.Equal(t, tr.file("c/a"), v.Corrupt[0].File)
+	require.Equal(t, Files{tr.file("b/a")}, v.Corrupt[0].Intact)
+	require.Equal(t, tr.file("a"), v.Corrupt[1].File)
+	require.Equal(t, Files{tr.file("b/a")}, v.Corrupt[1].Intact)
+	_, dx := testData("x")
+	require.Equal(t, dx, v.Corrupt[1].Actual)
+
+	v, err = s.Verify(context.Background(), tr, fsys, func(f *File) bool { return f.path == "b/a" })
+	require.NoError(t, err)
+	require.Equal(t, Files{tr.file("b/a")}, v.Verified)
+	require.Empty(t, v.Corrupt)
+}
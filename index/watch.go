@@ -0,0 +1,176 @@
+package index
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Watcher keeps an index up to date by monitoring file system events instead
+// of repeatedly scanning the whole tree. It is only supported on Linux.
+type Watcher struct {
+	Scanner // Options for hashing and full rescans
+
+	// SaveFn is called with the updated index at most once per SaveRate
+	// interval if there were any changes, and once more when Watch returns.
+	SaveFn   func(*Index)
+	SaveRate time.Duration
+
+	// Delay is the time that a file must remain unchanged before it is hashed.
+	Delay time.Duration
+}
+
+// Watch synchronizes x with the contents of root and then keeps it updated
+// until ctx is canceled. If the kernel event queue overflows, the index is
+// synchronized again with a full rescan. Files that are modified while being
+// hashed are retried as configured by the Scanner and then recorded with
+// ModifiedErr until they change again. Watch always returns a non-nil error.
+func (w *Watcher) Watch(ctx context.Context, x *Index, root string) error {
+	return w.watch(ctx, x, root)
+}
+
+// liveIndex is a mutable index representation that is updated one file at a
+// time. Flag handling matches that of Rescan.
+type liveIndex struct {
+	root  string
+	hash  Algorithm
+	mtime TimeTolerance
+	errs  []*FileError    // Paths that could not be indexed
+	alloc map[path]int64  // Allocated sizes of sparse files
+	sums  map[Digest]Sums // Secondary digests
+	sec   []Algorithm     // Secondary digest algorithms
+	files map[path]*File  // Existing files
+	gone  Files           // Removed or modified files with persistent flags
+	dirty bool
+
+	chunks map[Digest][]Chunk // Content-defined chunks
+	csize  int                // Average chunk size
+}
+
+// newLiveIndex converts x to a liveIndex.
+func newLiveIndex(x *Index) *liveIndex {
+	l := &liveIndex{
+		root:  x.root,
+		hash:  x.hash,
+		mtime: x.mtime,
+		errs:  slices.Clone(x.errs),
+		alloc: maps.Clone(x.alloc),
+		sums:  maps.Clone(x.sums),
+		sec:   x.secondary,
+		files: make(map[path]*File),
+
+		chunks: maps.Clone(x.chunks),
+		csize:  x.chunkSize,
+	}
+	if l.alloc == nil {
+		l.alloc = make(map[path]int64)
+	}
+	if l.sums == nil {
+		l.sums = make(map[Digest]Sums)
+	}
+	if l.chunks == nil {
+		l.chunks = make(map[Digest][]Chunk)
+	}
+	for _, g := range x.groups {
+		for _, f := range g {
+			if f.flag &= flagPersist | flagPartial; f.flag.IsGone() {
+				l.gone = append(l.gone, f)
+			} else {
+				l.files[f.path] = f
+			}
+		}
+	}
+	return l
+}
+
+// index returns the current index.
+func (l *liveIndex) index() *Index {
+	all := make(Files, 0, len(l.files)+len(l.gone))
+	for _, f := range l.files {
+		all = append(all, f)
+	}
+	all = append(all, l.gone...)
+	all.Sort()
+	x := New(l.root, all)
+	x.hash, x.mtime, x.secondary, x.chunkSize = l.hash, l.mtime, l.sec, l.csize
+	x.setErrs(slices.Clone(l.errs))
+	x.setSums(l.sums)
+	x.setChunks(l.chunks)
+	if len(l.alloc) > 0 {
+		x.alloc = maps.Clone(l.alloc)
+	}
+	return x
+}
+
+// isSame returns whether the existing file p has the specified info.
+func (l *liveIndex) isSame(p path, fi fs.FileInfo) bool {
+	f := l.files[p]
+	return f != nil && f.isSame(l.mtime, fi, nil)
+}
+
+// put adds or replaces a file.
+func (l *liveIndex) put(f *File) {
+	l.remove(f.path)
+	l.files[f.path] = f
+	l.dirty = true
+}
+
+// remove removes file p and any errors recorded for it.
+func (l *liveIndex) remove(p path) {
+	l.clearErr(p)
+	delete(l.alloc, p)
+	if f := l.files[p]; f != nil {
+		delete(l.files, p)
+		if f.flag&flagKeep != 0 {
+			f.flag |= flagGone
+			l.gone = append(l.gone, f)
+		}
+		l.dirty = true
+	}
+}
+
+// fail records the error of a file that could not be indexed and removes its
+// stale digest, if any.
+func (l *liveIndex) fail(fe *FileError) {
+	l.remove(path(fe.Path))
+	if e := fe.entry(); e != nil {
+		l.errs = append(l.errs, e)
+		l.dirty = true
+	}
+}
+
+// clearErr removes any recorded errors for file p.
+func (l *liveIndex) clearErr(p path) {
+	n := len(l.errs)
+	if l.errs = slices.DeleteFunc(l.errs, func(e *FileError) bool { return e.Path == string(p) }); len(l.errs) != n {
+		l.dirty = true
+	}
+}
+
+// removeDir removes all files under directory p.
+func (l *liveIndex) removeDir(p path) {
+	for fp := range l.files {
+		if p.contains(fp) {
+			l.remove(fp)
+		}
+	}
+}
+
+// rescan synchronizes the index with the contents of fsys.
+func (l *liveIndex) rescan(ctx context.Context, s *Scanner, fsys fs.FS) error {
+	x, err := s.Rescan(ctx, l.index().ToTree(), fsys)
+	if err != nil {
+		return err
+	}
+	*l = *newLiveIndex(x)
+	l.dirty = true
+	return nil
+}
+
+// validName returns whether name can be stored in the index.
+func validName(name string) bool {
+	return len(name) > 0 && name[0] != '\t' && strings.IndexByte(name, '\n') < 0
+}
@@ -0,0 +1,281 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask is the set of inotify events monitored for each directory.
+const watchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE |
+	unix.IN_ONLYDIR | inDontFollow | unix.IN_EXCL_UNLINK
+
+// inDontFollow is IN_DONTFOLLOW from linux/inotify.h.
+const inDontFollow = 0x2000000
+
+func (w *Watcher) watch(ctx context.Context, x *Index, root string) error {
+	root = filepath.Clean(root)
+	fsys := os.DirFS(root)
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("index: inotify init error (%w)", err)
+	}
+	n := &inotify{w: w, root: root, fd: fd, f: os.NewFile(uintptr(fd), "inotify"), dirs: make(map[int32]string)}
+	defer func() { _ = n.f.Close() }()
+
+	// Add watches before the initial rescan to avoid missing any events
+	n.addTree(".")
+	live := newLiveIndex(x)
+	live.root, live.mtime = root, w.MTime
+	if err = live.rescan(ctx, &w.Scanner, fsys); err != nil {
+		return err
+	}
+	events := make(chan []byte, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go n.read(events, done)
+
+	// Start hashers
+	file := make(chan *File, 1)
+	werr := make(chan error, 1)
+	cp := ctxPoller(ctx.Done())
+	wk := &walker{Scanner: &w.Scanner, fsys: fsys, file: file, werr: werr}
+	hash := wk.start(cp, w.monitor(cp, nil))
+	defer func() {
+		close(hash)
+		for {
+			select {
+			case _, ok := <-file:
+				if !ok {
+					return
+				}
+			case <-werr:
+			}
+		}
+	}()
+	go func() {
+		wk.wg.Wait()
+		close(file)
+	}()
+
+	tick := time.NewTicker(max(w.Delay/2, 100*time.Millisecond))
+	defer tick.Stop()
+	pending := make(map[string]time.Time)
+	var queue []string
+	lastSave := time.Now()
+	for {
+		var next chan<- string
+		if len(queue) > 0 {
+			next = hash
+		}
+		select {
+		case b := <-events:
+			if n.handle(b, live, pending) {
+				n.addTree(".")
+				if err = live.rescan(ctx, &w.Scanner, fsys); err != nil {
+					break
+				}
+			}
+		case next <- queueHead(queue):
+			queue = queue[1:]
+		case f := <-file:
+			live.put(f)
+			if a, ok := wk.takeAlloc(f.path); ok {
+				live.alloc[f.path] = a
+			}
+			if s, ok := wk.takeSums(f.digest); ok {
+				live.sums[f.digest] = s
+			}
+			if c, ok := wk.takeChunks(f.digest); ok {
+				live.chunks[f.digest] = c
+			}
+		case err := <-werr:
+			var fe *FileError
+			switch {
+			case errors.As(err, &fe) && errors.Is(err, fs.ErrNotExist):
+				live.remove(path(fe.Path))
+			default:
+				if fe != nil {
+					live.fail(fe)
+				}
+				if w.ErrFn != nil {
+					w.ErrFn(err)
+				}
+			}
+		case now := <-tick.C:
+			for name, t := range pending {
+				if now.Sub(t) < w.Delay {
+					continue
+				}
+				delete(pending, name)
+				// Symlinks are not followed, matching the walker
+				fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name)))
+				switch {
+				case err != nil || !fi.Mode().IsRegular():
+					live.remove(path(name))
+					if err == nil && !fi.IsDir() {
+						n.err(fileError(TypeErr, name, nil))
+					}
+				case !live.isSame(path(name), fi):
+					queue = append(queue, name)
+				}
+			}
+			if live.dirty && now.Sub(lastSave) >= w.SaveRate && w.SaveFn != nil {
+				live.dirty, lastSave = false, now
+				w.SaveFn(live.index())
+			}
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			if live.dirty && w.SaveFn != nil {
+				w.SaveFn(live.index())
+			}
+			return err
+		}
+	}
+}
+
+// queueHead returns the first name in q or "" if q is empty.
+func queueHead(q []string) string {
+	if len(q) > 0 {
+		return q[0]
+	}
+	return ""
+}
+
+// inotify maintains recursive directory watches.
+type inotify struct {
+	w    *Watcher
+	root string
+	fd   int
+	f    *os.File         // Non-blocking fd wrapper for Read and Close
+	dirs map[int32]string // Watch descriptor to relative directory path
+}
+
+// addTree adds watches for directory name and all of its subdirectories.
+func (n *inotify) addTree(name string) {
+	_ = filepath.WalkDir(filepath.Join(n.root, name), func(p string, e fs.DirEntry, err error) error {
+		if err != nil || !e.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(n.root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && !validName(rel) {
+			return fs.SkipDir
+		}
+		wd, err := unix.InotifyAddWatch(n.fd, p, watchMask)
+		if err != nil {
+			n.err(fileError(WalkErr, rel, err))
+			return nil
+		}
+		n.dirs[int32(wd)] = rel
+		return nil
+	})
+}
+
+// removeTree removes watches for directory name and all of its subdirectories.
+func (n *inotify) removeTree(name string) {
+	p := dirPath(name)
+	for wd, dir := range n.dirs {
+		if p.contains(dirPath(dir)) {
+			_, _ = unix.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.dirs, wd)
+		}
+	}
+}
+
+// read sends raw event buffers to events until the inotify file is closed or
+// done is closed.
+func (n *inotify) read(events chan<- []byte, done <-chan struct{}) {
+	b := make([]byte, 64*1024)
+	for {
+		k, err := n.f.Read(b)
+		if err != nil {
+			return
+		}
+		select {
+		case events <- append([]byte(nil), b[:k]...):
+		case <-done:
+			return
+		}
+	}
+}
+
+// handle processes a buffer of inotify events. Files that need to be hashed
+// are added to pending. It returns true if the event queue overflowed and a
+// full rescan is required.
+func (n *inotify) handle(b []byte, live *liveIndex, pending map[string]time.Time) (overflow bool) {
+	now := time.Now()
+	for len(b) >= unix.SizeofInotifyEvent {
+		e := (*unix.InotifyEvent)(unsafe.Pointer(&b[0]))
+		end := unix.SizeofInotifyEvent + int(e.Len)
+		name := string(b[unix.SizeofInotifyEvent:end])
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		b = b[end:]
+		if e.Mask&unix.IN_Q_OVERFLOW != 0 {
+			overflow = true
+			continue
+		}
+		dir, ok := n.dirs[e.Wd]
+		if !ok {
+			continue
+		}
+		if e.Mask&unix.IN_IGNORED != 0 {
+			delete(n.dirs, e.Wd)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if dir != "." {
+			name = dir + "/" + name
+		}
+		if !validName(name) {
+			n.err(fileError(PathErr, name, nil))
+			continue
+		}
+		if e.Mask&unix.IN_ISDIR != 0 {
+			switch {
+			case e.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+				n.removeTree(name)
+				live.removeDir(dirPath(name))
+			case e.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+				n.addTree(name)
+				_ = fs.WalkDir(os.DirFS(n.root), name, func(p string, e fs.DirEntry, err error) error {
+					if err == nil && e.Type().IsRegular() && validName(p) {
+						pending[p] = now
+					}
+					return nil
+				})
+			}
+			continue
+		}
+		if e.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+			delete(pending, name)
+			live.remove(path(name))
+		} else {
+			pending[name] = now
+		}
+	}
+	return
+}
+
+func (n *inotify) err(err error) {
+	if n.w.ErrFn != nil {
+		n.w.ErrFn(err)
+	}
+}
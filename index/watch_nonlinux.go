@@ -0,0 +1,12 @@
+//go:build !linux
+
+package index
+
+import (
+	"context"
+	"errors"
+)
+
+func (w *Watcher) watch(context.Context, *Index, string) error {
+	return errors.ErrUnsupported
+}
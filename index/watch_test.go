@@ -0,0 +1,115 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify required")
+	}
+	root := t.TempDir()
+	write := func(name, data string) {
+		name = filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte(data), 0o644))
+	}
+	write("a", "a")
+	write("b", "b")
+	write("d/c", "c")
+	x, err := Scan(context.Background(), os.DirFS(root), nil, nil)
+	require.NoError(t, err)
+	tr := x.ToTree()
+	tr.file("b").flag = flagKeep
+	x = tr.ToIndex()
+
+	saved := make(chan *Index, 16)
+	errFn := func(err error) {
+		if fe := (*FileError)(nil); !errors.As(err, &fe) || fe.Kind != TypeErr {
+			t.Error(err) // Symlinks are reported as not regular
+		}
+	}
+	w := Watcher{
+		Scanner: Scanner{ErrFn: errFn},
+		SaveFn:  func(x *Index) { saved <- x },
+		Delay:   50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx, x, root) }()
+	<-saved // Initial rescan
+
+	// want waits for an index that contains the specified files
+	want := func(files map[path]Flag) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case x := <-saved:
+				have := make(map[path]Flag)
+				for _, f := range x.Files() {
+					have[f.path] |= f.flag & flagPersist
+				}
+				if len(have) == len(files) {
+					ok := true
+					for p, fl := range files {
+						if have[p] != fl {
+							ok = false
+						}
+					}
+					if ok {
+						return
+					}
+				}
+			case <-timeout:
+				t.Fatal("timeout waiting for index update")
+			}
+		}
+	}
+	write("e", "e")
+	write("d/f/g", "g")
+	require.NoError(t, os.Remove(filepath.Join(root, "a")))
+	require.NoError(t, os.Remove(filepath.Join(root, "b")))
+	want(map[path]Flag{"b": flagKeep | flagGone, "d/c": 0, "d/f/g": 0, "e": 0})
+
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "d")))
+	want(map[path]Flag{"b": flagKeep | flagGone, "e": 0})
+
+	// Symlinks are not indexed
+	require.NoError(t, os.Symlink("e", filepath.Join(root, "link")))
+	write("h", "h")
+	want(map[path]Flag{"b": flagKeep | flagGone, "e": 0, "h": 0})
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestLiveIndexFail(t *testing.T) {
+	x, err := Scan(context.Background(), fstest.MapFS{
+		"a": {Data: []byte("a")},
+		"b": {Data: []byte("b")},
+	}, nil, nil)
+	require.NoError(t, err)
+	l := newLiveIndex(x)
+	l.fail(fileError(ReadErr, "a", io.ErrUnexpectedEOF))
+	l.fail(fileError(OpenErr, "a", fs.ErrPermission))
+	x = l.index()
+	require.Len(t, x.Files(), 1)
+	require.Equal(t, path("b"), x.Files()[0].path)
+	require.Equal(t, []*FileError{fileError(OpenErr, "a", nil)}, x.Errors())
+
+	// Indexing the file again clears the error
+	l.put(&File{path: "a", size: 1})
+	require.Empty(t, l.index().Errors())
+}
@@ -0,0 +1,49 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// xattrName is the extended attribute used to cache file digests.
+const xattrName = "user.fsx.blake3"
+
+// xattrEntry is a file digest cached in an extended attribute. The digest is
+// only valid if the file still has the same size, modification time, and inode
+// number.
+type xattrEntry struct {
+	size   int64
+	mtime  int64 // Unix nanoseconds
+	ino    uint64
+	digest Digest
+}
+
+// marshal returns the attribute value.
+func (e *xattrEntry) marshal() []byte {
+	return fmt.Appendf(nil, "%d %d %d %x", e.size, e.mtime, e.ino, e.digest)
+}
+
+// unmarshal decodes the attribute value.
+func (e *xattrEntry) unmarshal(b []byte) bool {
+	f := bytes.Fields(b)
+	if len(f) != 4 || hex.DecodedLen(len(f[3])) != len(e.digest) {
+		return false
+	}
+	var err [3]error
+	e.size, err[0] = strconv.ParseInt(string(f[0]), 10, 64)
+	e.mtime, err[1] = strconv.ParseInt(string(f[1]), 10, 64)
+	e.ino, err[2] = strconv.ParseUint(string(f[2]), 10, 64)
+	_, err3 := hex.Decode(e.digest[:], f[3])
+	return err[0] == nil && err[1] == nil && err[2] == nil && err3 == nil
+}
+
+// ClearCache removes stale digests cached in extended attributes of files
+// under root. If all is true, all cached digests are removed. It returns the
+// number of attributes removed. If errFn is non-nil, it is called for any
+// file-specific errors.
+func ClearCache(ctx context.Context, root string, all bool, errFn func(error)) (int, error) {
+	return clearCache(ctxPoller(ctx.Done()), root, all, errFn)
+}
@@ -0,0 +1,109 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrSupported indicates whether the digest cache is supported.
+const xattrSupported = true
+
+// cacheKey returns the cache entry for a file with the specified info.
+func cacheKey(fi fs.FileInfo) (xattrEntry, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || fi.Size() == 0 {
+		return xattrEntry{}, false
+	}
+	return xattrEntry{size: fi.Size(), mtime: fi.ModTime().UnixNano(), ino: st.Ino}, true
+}
+
+// getCache returns the digest of file f cached in its extended attributes if
+// it is still valid.
+func getCache(f fs.File, fi fs.FileInfo) (Digest, bool) {
+	want, ok := cacheKey(fi)
+	osf, isOS := f.(*os.File)
+	if !ok || !isOS {
+		return Digest{}, false
+	}
+	rc, err := osf.SyscallConn()
+	if err != nil {
+		return Digest{}, false
+	}
+	var b [128]byte
+	n := -1
+	_ = rc.Control(func(fd uintptr) { n, err = unix.Fgetxattr(int(fd), xattrName, b[:]) })
+	var have xattrEntry
+	if err != nil || n < 0 || !have.unmarshal(b[:n]) {
+		return Digest{}, false
+	}
+	want.digest = have.digest
+	return have.digest, have == want
+}
+
+// setCache stores digest d of file f in its extended attributes. Errors are
+// ignored because the cache is optional and the file system may not support
+// extended attributes or the user may not have write access.
+func setCache(f fs.File, fi fs.FileInfo, d Digest) {
+	e, ok := cacheKey(fi)
+	osf, isOS := f.(*os.File)
+	if !ok || !isOS {
+		return
+	}
+	e.digest = d
+	if rc, err := osf.SyscallConn(); err == nil {
+		_ = rc.Control(func(fd uintptr) { _ = unix.Fsetxattr(int(fd), xattrName, e.marshal(), 0) })
+	}
+}
+
+// clearCache removes stale or all cached digests under root.
+func clearCache(cp ctxPoller, root string, all bool, errFn func(error)) (n int, err error) {
+	var b [128]byte
+	err = filepath.WalkDir(root, func(name string, e fs.DirEntry, err error) error {
+		if cp.canceled() {
+			return fs.SkipAll
+		}
+		if err != nil {
+			if errFn != nil {
+				errFn(fileError(WalkErr, name, err))
+			}
+			return nil
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+		sz, err := unix.Lgetxattr(name, xattrName, b[:])
+		if err != nil {
+			if errFn != nil && !errors.Is(err, unix.ENODATA) && !errors.Is(err, unix.ENOTSUP) {
+				errFn(fileError(XattrErr, name, err))
+			}
+			return nil
+		}
+		if !all {
+			var have xattrEntry
+			fi, err := e.Info()
+			if want, ok := cacheKey(fi); err == nil && ok && have.unmarshal(b[:sz]) {
+				if want.digest = have.digest; have == want {
+					return nil
+				}
+			}
+		}
+		if err = unix.Lremovexattr(name, xattrName); err != nil {
+			if errFn != nil {
+				errFn(fileError(XattrErr, name, err))
+			}
+			return nil
+		}
+		n++
+		return nil
+	})
+	if cp.canceled() {
+		err = context.Canceled
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package index
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestScanXattrCache(t *testing.T) {
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	require.NoError(t, os.WriteFile(a, []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(b, []byte("b"), 0o644))
+	if err := unix.Setxattr(a, xattrName, []byte("x"), 0); err != nil {
+		t.Skipf("xattrs not supported: %v", err)
+	}
+	fsys := os.DirFS(root)
+	s := Scanner{XattrCache: true}
+	want, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+
+	// Replace cached digest of a
+	fi, err := os.Stat(a)
+	require.NoError(t, err)
+	e, ok := cacheKey(fi)
+	require.True(t, ok)
+	e.digest = Digest{1}
+	require.NoError(t, unix.Setxattr(a, xattrName, e.marshal(), 0))
+	have, err := s.Scan(context.Background(), fsys)
+	require.NoError(t, err)
+	tr := have.ToTree()
+	require.Equal(t, Digest{1}, tr.file("a").digest)
+	require.Equal(t, want.ToTree().file("b").digest, tr.file("b").digest)
+
+	// Verify ignores the cache
+	v, err := s.Verify(context.Background(), tr, fsys, nil)
+	require.NoError(t, err)
+	require.Len(t, v.Corrupt, 1)
+
+	// Clear stale and then all cached digests
+	n, err := ClearCache(context.Background(), root, false, nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.NoError(t, os.Chtimes(a, time.Time{}, fi.ModTime().Add(time.Second)))
+	n, err = ClearCache(context.Background(), root, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	n, err = ClearCache(context.Background(), root, true, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = unix.Getxattr(b, xattrName, nil)
+	require.ErrorIs(t, err, unix.ENODATA)
+}
+
+func TestReadXattrCache(t *testing.T) {
+	root := t.TempDir()
+	a, e := filepath.Join(root, "a"), filepath.Join(root, "e")
+	require.NoError(t, os.WriteFile(a, []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(e, nil, 0o644))
+	if err := unix.Setxattr(a, xattrName, []byte("x"), 0); err != nil {
+		t.Skipf("xattrs not supported: %v", err)
+	}
+	require.NoError(t, unix.Removexattr(a, xattrName))
+	h := NewHasher(nil)
+	h.xattr = true
+
+	// Files modified while hashing are not cached
+	_, err := h.Read(modifiedFS{os.DirFS(root)}, "a", true)
+	require.ErrorContains(t, err, "modified")
+	_, err = unix.Getxattr(a, xattrName, nil)
+	require.ErrorIs(t, err, unix.ENODATA)
+
+	// Name-based digests are not cached
+	_, err = h.Read(os.DirFS(root), "e", true)
+	require.NoError(t, err)
+	_, err = unix.Getxattr(e, xattrName, nil)
+	require.ErrorIs(t, err, unix.ENODATA)
+
+	_, err = h.Read(os.DirFS(root), "a", true)
+	require.NoError(t, err)
+	_, err = unix.Getxattr(a, xattrName, nil)
+	require.NoError(t, err)
+}
+
+// modifiedFS reports a new modification time for every file after it is
+// opened.
+type modifiedFS struct{ fs.FS }
+
+func (m modifiedFS) Stat(name string) (fs.FileInfo, error) {
+	fi, err := fs.Stat(m.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	return modifiedInfo{fi}, nil
+}
+
+type modifiedInfo struct{ fs.FileInfo }
+
+func (fi modifiedInfo) ModTime() time.Time { return fi.FileInfo.ModTime().Add(time.Second) }
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package index
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// xattrSupported indicates whether the digest cache is supported.
+const xattrSupported = false
+
+// getCache is not supported on non-Linux systems.
+func getCache(fs.File, fs.FileInfo) (Digest, bool) { return Digest{}, false }
+
+// setCache is a no-op on non-Linux systems.
+func setCache(fs.File, fs.FileInfo, Digest) {}
+
+// clearCache returns errors.ErrUnsupported.
+func clearCache(ctxPoller, string, bool, func(error)) (int, error) {
+	return 0, errors.ErrUnsupported
+}
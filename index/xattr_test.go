@@ -0,0 +1,16 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXattrEntry(t *testing.T) {
+	want := xattrEntry{size: 1, mtime: -2, ino: 3, digest: Digest{4}}
+	var have xattrEntry
+	require.True(t, have.unmarshal(want.marshal()))
+	require.Equal(t, want, have)
+	require.False(t, have.unmarshal([]byte("1 2 3")))
+	require.False(t, have.unmarshal([]byte("1 2 3 04")))
+}